@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,11 +10,26 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
+	"time"
 )
 
-func (c *QuayClient) GetRobotAccount(namespaceType string, namespaceName string, robotName string) (RobotAccount, *http.Response, QuayApiError) {
+// GetCurrentUser returns the user the client authenticates as
+func (c *QuayClient) GetCurrentUser(ctx context.Context) (User, *http.Response, QuayApiError) {
 
-	req, err := c.newRequest("GET", fmt.Sprintf("/api/v1/%s/%s/robots/%s", namespaceType, namespaceName, robotName), nil)
+	req, err := c.newRequest(ctx, "GET", "/api/v1/user/", nil)
+	if err != nil {
+		return User{}, nil, QuayApiError{Error: err}
+	}
+	var getUserResponse User
+	resp, err := c.do(req, &getUserResponse)
+
+	return getUserResponse, resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) GetRobotAccount(ctx context.Context, namespaceType string, namespaceName string, robotName string) (RobotAccount, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("%s/%s", robotsPath(namespaceType, namespaceName), robotName), nil)
 	if err != nil {
 		return RobotAccount{}, nil, QuayApiError{Error: err}
 	}
@@ -23,21 +39,77 @@ func (c *QuayClient) GetRobotAccount(namespaceType string, namespaceName string,
 	return getRobotResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) CreateRobotAccount(namespaceType string, namespaceName string, robotName string) (RobotAccount, *http.Response, QuayApiError) {
+// ListRobotAccounts returns every robot account of a namespace, following pages until all have been retrieved
+func (c *QuayClient) ListRobotAccounts(ctx context.Context, namespaceType string, namespaceName string, options *ListRobotAccountsOptions) ([]RobotAccount, *http.Response, QuayApiError) {
+
+	query := url.Values{}
+	if options != nil {
+		if options.Permissions {
+			query.Set("permissions", "true")
+		}
+		if options.Token {
+			query.Set("token", "true")
+		}
+		if options.Limit > 0 {
+			query.Set("limit", strconv.Itoa(options.Limit))
+		}
+	}
+
+	robots := []RobotAccount{}
+	var resp *http.Response
+
+	for {
+
+		path := robotsPath(namespaceType, namespaceName)
+		if encodedQuery := query.Encode(); encodedQuery != "" {
+			path = fmt.Sprintf("%s?%s", path, encodedQuery)
+		}
+
+		req, err := c.newRequest(ctx, "GET", path, nil)
+		if err != nil {
+			return robots, nil, QuayApiError{Error: err}
+		}
 
-	req, err := c.newRequest("PUT", fmt.Sprintf("/api/v1/%s/%s/robots/%s", namespaceType, namespaceName, robotName), nil)
+		var listRobotsResponse RobotAccountsResponse
+		resp, err = c.do(req, &listRobotsResponse)
+
+		if err != nil {
+			return robots, resp, QuayApiError{Error: err}
+		}
+
+		robots = append(robots, listRobotsResponse.Robots...)
+
+		if listRobotsResponse.NextPage != nil && *listRobotsResponse.NextPage != "" {
+			query.Set("next_page", *listRobotsResponse.NextPage)
+			continue
+		}
+
+		return robots, resp, QuayApiError{Error: nil}
+
+	}
+}
+
+func (c *QuayClient) CreateRobotAccount(ctx context.Context, namespaceType string, namespaceName string, robotName string, robotAccountRequest *RobotAccountRequest) (RobotAccount, *http.Response, QuayApiError) {
+
+	var body interface{}
+	if robotAccountRequest != nil {
+		body = robotAccountRequest
+	}
+
+	req, err := c.newRequest(ctx, "PUT", fmt.Sprintf("%s/%s", robotsPath(namespaceType, namespaceName), robotName), body)
 	if err != nil {
 		return RobotAccount{}, nil, QuayApiError{Error: err}
 	}
 	var createRobotResponse RobotAccount
-	resp, err := c.do(req, &createRobotResponse)
+	// Creating a robot account that exists fails, so a retry would fail if an earlier attempt created the robot account
+	resp, err := c.do(nonIdempotent(req), &createRobotResponse)
 
 	return createRobotResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) DeleteRobotAccount(namespaceType string, namespaceName string, robotName string) (*http.Response, QuayApiError) {
+func (c *QuayClient) DeleteRobotAccount(ctx context.Context, namespaceType string, namespaceName string, robotName string) (*http.Response, QuayApiError) {
 
-	req, err := c.newRequest("DELETE", fmt.Sprintf("/api/v1/%s/%s/robots/%s", namespaceType, namespaceName, robotName), nil)
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("%s/%s", robotsPath(namespaceType, namespaceName), robotName), nil)
 	if err != nil {
 		return nil, QuayApiError{Error: err}
 	}
@@ -46,9 +118,9 @@ func (c *QuayClient) DeleteRobotAccount(namespaceType string, namespaceName stri
 	return resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) RegenerateRobotAccountPassword(namespaceType string, namespaceName string, robotName string) (RobotAccount, *http.Response, QuayApiError) {
+func (c *QuayClient) RegenerateRobotAccountPassword(ctx context.Context, namespaceType string, namespaceName string, robotName string) (RobotAccount, *http.Response, QuayApiError) {
 
-	req, err := c.newRequest("POST", fmt.Sprintf("/api/v1/%s/%s/robots/%s/regenerate", namespaceType, namespaceName, robotName), nil)
+	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("%s/%s/regenerate", robotsPath(namespaceType, namespaceName), robotName), nil)
 	if err != nil {
 		return RobotAccount{}, nil, QuayApiError{Error: err}
 	}
@@ -58,9 +130,10 @@ func (c *QuayClient) RegenerateRobotAccountPassword(namespaceType string, namesp
 	return regenerateRobotAccountResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) CreateTeam(namespaceName string, team *Team) (Team, *http.Response, QuayApiError) {
+// CreateTeam creates a team or updates the role and description of an existing team
+func (c *QuayClient) CreateTeam(ctx context.Context, namespaceName string, team *Team) (Team, *http.Response, QuayApiError) {
 
-	req, err := c.newRequest("PUT", fmt.Sprintf("/api/v1/organization/%s/team/%s", namespaceName, team.Name), team)
+	req, err := c.newRequest(ctx, "PUT", fmt.Sprintf("/api/v1/organization/%s/team/%s", namespaceName, team.Name), team)
 	if err != nil {
 		return Team{}, nil, QuayApiError{Error: err}
 	}
@@ -70,9 +143,31 @@ func (c *QuayClient) CreateTeam(namespaceName string, team *Team) (Team, *http.R
 	return createTeamResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) AddTeamMember(namespaceName, teamName, memberName string) (*http.Response, QuayApiError) {
+func (c *QuayClient) DeleteTeam(ctx context.Context, namespaceName, teamName string) (*http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/organization/%s/team/%s", namespaceName, teamName), nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	resp, err := c.do(req, nil)
+
+	return resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) AddTeamMember(ctx context.Context, namespaceName, teamName, memberName string) (*http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "PUT", fmt.Sprintf("/api/v1/organization/%s/team/%s/members/%s", namespaceName, teamName, memberName), nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	resp, err := c.do(req, nil)
+
+	return resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) RemoveTeamMember(ctx context.Context, namespaceName, teamName, memberName string) (*http.Response, QuayApiError) {
 
-	req, err := c.newRequest("PUT", fmt.Sprintf("/api/v1/organization/%s/team/%s/members/%s", namespaceName, teamName, memberName), nil)
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/organization/%s/team/%s/members/%s", namespaceName, teamName, memberName), nil)
 	if err != nil {
 		return nil, QuayApiError{Error: err}
 	}
@@ -81,9 +176,33 @@ func (c *QuayClient) AddTeamMember(namespaceName, teamName, memberName string) (
 	return resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) GetPrototypesByOrganization(organizationName string) (PrototypesResponse, *http.Response, QuayApiError) {
+func (c *QuayClient) GetTeamMembers(ctx context.Context, namespaceName, teamName string) (TeamMembersResponse, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/api/v1/organization/%s/team/%s/members", namespaceName, teamName), nil)
+	if err != nil {
+		return TeamMembersResponse{}, nil, QuayApiError{Error: err}
+	}
+	var getTeamMembersResponse TeamMembersResponse
+	resp, err := c.do(req, &getTeamMembersResponse)
+
+	return getTeamMembersResponse, resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) GetOrganization(ctx context.Context, organizationName string) (Organization, *http.Response, QuayApiError) {
 
-	req, err := c.newRequest("GET", fmt.Sprintf("/api/v1/organization/%s/prototypes", organizationName), nil)
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/api/v1/organization/%s", organizationName), nil)
+	if err != nil {
+		return Organization{}, nil, QuayApiError{Error: err}
+	}
+	var getOrganizationResponse Organization
+	resp, err := c.do(req, &getOrganizationResponse)
+
+	return getOrganizationResponse, resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) GetPrototypesByOrganization(ctx context.Context, organizationName string) (PrototypesResponse, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/api/v1/organization/%s/prototypes", organizationName), nil)
 	if err != nil {
 		return PrototypesResponse{}, nil, QuayApiError{Error: err}
 	}
@@ -93,7 +212,7 @@ func (c *QuayClient) GetPrototypesByOrganization(organizationName string) (Proto
 	return getPrototypeResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) CreateRobotPermissionForOrganization(organizationName string, robotAccount string, role string) (Prototype, *http.Response, QuayApiError) {
+func (c *QuayClient) CreateRobotPermissionForOrganization(ctx context.Context, organizationName string, robotAccount string, role string) (Prototype, *http.Response, QuayApiError) {
 
 	robotOrganizationPermission := Prototype{
 		Role: role,
@@ -105,7 +224,7 @@ func (c *QuayClient) CreateRobotPermissionForOrganization(organizationName strin
 		},
 	}
 
-	req, err := c.newRequest("POST", fmt.Sprintf("/api/v1/organization/%s/prototypes", organizationName), robotOrganizationPermission)
+	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("/api/v1/organization/%s/prototypes", organizationName), robotOrganizationPermission)
 	if err != nil {
 		return Prototype{}, nil, QuayApiError{Error: err}
 	}
@@ -115,9 +234,20 @@ func (c *QuayClient) CreateRobotPermissionForOrganization(organizationName strin
 	return newPrototypeResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) GetRobotPermissions(organizationName, robotName string) (PermissionsResponse, *http.Response, QuayApiError) {
+func (c *QuayClient) DeletePrototype(ctx context.Context, organizationName string, prototypeID string) (*http.Response, QuayApiError) {
 
-	req, err := c.newRequest("GET", fmt.Sprintf("/api/v1/organization/%s/robots/%s/permissions", organizationName, robotName), nil)
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/organization/%s/prototypes/%s", organizationName, prototypeID), nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	resp, err := c.do(req, nil)
+
+	return resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) GetRobotPermissions(ctx context.Context, namespaceType string, namespaceName string, robotName string) (PermissionsResponse, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("%s/%s/permissions", robotsPath(namespaceType, namespaceName), robotName), nil)
 	if err != nil {
 		return PermissionsResponse{}, nil, QuayApiError{Error: err}
 	}
@@ -127,11 +257,10 @@ func (c *QuayClient) GetRobotPermissions(organizationName, robotName string) (Pe
 	return getPermissionsResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) UpdateRepositoryUserPermission(namespace, repositoryName, roleName, permission string) (*Team, *http.Response, QuayApiError) {
-
-	robotName := fmt.Sprintf("%s+%s", namespace, roleName)
+// UpdateRepositoryUserPermission grants a user or a robot account, identified by its full name (<namespace>+<robot>), a permission on a repository
+func (c *QuayClient) UpdateRepositoryUserPermission(ctx context.Context, namespace, repositoryName, userName, permission string) (*Team, *http.Response, QuayApiError) {
 
-	req, err := c.newRequest("PUT", fmt.Sprintf("/api/v1/repository/%s/%s/permissions/user/%s", namespace, repositoryName, robotName), &PermissionUpdateRequest{
+	req, err := c.newRequest(ctx, "PUT", fmt.Sprintf("/api/v1/repository/%s/%s/permissions/user/%s", namespace, repositoryName, userName), &PermissionUpdateRequest{
 		Role: permission,
 	})
 	if err != nil {
@@ -143,7 +272,19 @@ func (c *QuayClient) UpdateRepositoryUserPermission(namespace, repositoryName, r
 	return &createTeamResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) GetRepositoriesForNamespace(namespace string) ([]Repository, *http.Response, QuayApiError) {
+// DeleteRepositoryUserPermission removes the permission of a user or a robot account, identified by its full name (<namespace>+<robot>), on a repository
+func (c *QuayClient) DeleteRepositoryUserPermission(ctx context.Context, namespace, repositoryName, userName string) (*http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/repository/%s/%s/permissions/user/%s", namespace, repositoryName, userName), nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	resp, err := c.do(req, nil)
+
+	return resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) GetRepositoriesForNamespace(ctx context.Context, namespace string) ([]Repository, *http.Response, QuayApiError) {
 
 	repositories := []Repository{}
 	var resp *http.Response
@@ -151,7 +292,7 @@ func (c *QuayClient) GetRepositoriesForNamespace(namespace string) ([]Repository
 
 	for {
 
-		req, err := c.newRequest("GET", fmt.Sprintf("/api/v1/repository?namespace=%s%s", namespace, nextPageParameter), nil)
+		req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/api/v1/repository?namespace=%s%s", namespace, nextPageParameter), nil)
 		if err != nil {
 			return repositories, nil, QuayApiError{Error: err}
 		}
@@ -159,24 +300,78 @@ func (c *QuayClient) GetRepositoriesForNamespace(namespace string) ([]Repository
 		var getRepositoriesResponse RepositoriesResponse
 		resp, err = c.do(req, &getRepositoriesResponse)
 
-		if resp.StatusCode == 200 {
+		if err != nil {
+			return repositories, resp, QuayApiError{Error: err}
+		}
 
-			repositories = append(repositories, getRepositoriesResponse.Repositories...)
-
-			if getRepositoriesResponse.NextPage != nil {
-				nextPageParameter = fmt.Sprintf("&next_page=%s", *getRepositoriesResponse.NextPage)
-				continue
-			}
+		repositories = append(repositories, getRepositoriesResponse.Repositories...)
 
+		if getRepositoriesResponse.NextPage != nil {
+			nextPageParameter = fmt.Sprintf("&next_page=%s", url.QueryEscape(*getRepositoriesResponse.NextPage))
+			continue
 		}
 
-		return repositories, resp, QuayApiError{Error: err}
+		return repositories, resp, QuayApiError{Error: nil}
+
+	}
+
+}
 
+// CreateRepository creates an image repository in a namespace with the given visibility (public or private)
+func (c *QuayClient) CreateRepository(ctx context.Context, namespace, repositoryName, visibility, description string) (Repository, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "POST", "/api/v1/repository", &RepositoryCreateRequest{
+		Namespace:   namespace,
+		Repository:  repositoryName,
+		Visibility:  visibility,
+		Description: description,
+		RepoKind:    "image",
+	})
+	if err != nil {
+		return Repository{}, nil, QuayApiError{Error: err}
 	}
+	var createRepositoryResponse Repository
+	resp, err := c.do(req, &createRepositoryResponse)
 
+	return createRepositoryResponse, resp, QuayApiError{Error: err}
 }
 
-func (c *QuayClient) newRequest(method, path string, body interface{}) (*http.Request, error) {
+func (c *QuayClient) CreateApplicationToken(ctx context.Context, title string) (ApplicationToken, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "POST", "/api/v1/user/apptoken", &ApplicationTokenRequest{
+		Title: title,
+	})
+	if err != nil {
+		return ApplicationToken{}, nil, QuayApiError{Error: err}
+	}
+	var createApplicationTokenResponse ApplicationTokenResponse
+	resp, err := c.do(req, &createApplicationTokenResponse)
+
+	return createApplicationTokenResponse.Token, resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) RevokeApplicationToken(ctx context.Context, tokenUUID string) (*http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/user/apptoken/%s", tokenUUID), nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	resp, err := c.do(req, nil)
+
+	return resp, QuayApiError{Error: err}
+}
+
+// robotsPath returns the path of the robot accounts of a namespace. Quay only exposes the robot accounts
+// of the authenticated user, so user namespaces do not appear in the path
+func robotsPath(namespaceType string, namespaceName string) string {
+	if namespaceType == NamespaceTypeUser {
+		return "/api/v1/user/robots"
+	}
+
+	return fmt.Sprintf("/api/v1/organization/%s/robots", namespaceName)
+}
+
+func (c *QuayClient) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
 	rel, err := url.Parse(path)
 	if err != nil {
 		return nil, err
@@ -190,28 +385,50 @@ func (c *QuayClient) newRequest(method, path string, body interface{}) (*http.Re
 			return nil, err
 		}
 	}
-	req, err := http.NewRequest(method, u.String(), buf)
-
-	if !isZeroOfUnderlyingType(c.authToken) {
-		req.Header.Set("Authorization", "Bearer "+c.authToken)
-	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
 
 	if err != nil {
 		return nil, err
 	}
+
+	c.authenticate(req)
+
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("Accept", "application/json")
 	return req, nil
 }
+
+// authenticate adds the token, the basic auth credentials or the CSRF token of a session to a request
+func (c *QuayClient) authenticate(req *http.Request) {
+	if !isZeroOfUnderlyingType(c.authToken) {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	} else if !isZeroOfUnderlyingType(c.username) {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	if !isZeroOfUnderlyingType(c.csrfToken) {
+		req.Header.Set("X-CSRF-Token", c.csrfToken)
+	}
+}
+
 func (c *QuayClient) do(req *http.Request, v interface{}) (*http.Response, error) {
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		responseData, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return resp, err
+		}
+
+		return resp, newResponseError(req, resp, responseData)
+	}
+
 	if v != nil {
 
 		if _, ok := v.(*StringValue); ok {
@@ -234,10 +451,46 @@ func (c *QuayClient) do(req *http.Request, v interface{}) (*http.Response, error
 	return resp, err
 }
 
+// doWithRetry sends the request, retrying according to the retry policy of the client
+func (c *QuayClient) doWithRetry(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := c.httpClient.Do(req)
+
+		if !c.retryPolicy.shouldRetry(req, resp, err, attempt) {
+			return resp, err
+		}
+
+		delay := c.retryPolicy.delay(resp, attempt)
+
+		// Release the connection before the next attempt
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
 func NewClient(httpClient *http.Client, baseUrl string, authToken string) (*QuayClient, error) {
 	quayClient := QuayClient{
-		httpClient: httpClient,
-		authToken:  authToken,
+		httpClient:  httpClient,
+		authToken:   authToken,
+		retryPolicy: DefaultRetryPolicy(),
 	}
 
 	parsedUrl, err := url.Parse(baseUrl)
@@ -251,6 +504,21 @@ func NewClient(httpClient *http.Client, baseUrl string, authToken string) (*Quay
 	return &quayClient, nil
 }
 
+// NewClientWithBasicAuth returns a client that authenticates using a username and password,
+// such as the credentials of a robot account
+func NewClientWithBasicAuth(httpClient *http.Client, baseUrl string, username string, password string) (*QuayClient, error) {
+	quayClient, err := NewClient(httpClient, baseUrl, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	quayClient.username = username
+	quayClient.password = password
+
+	return quayClient, nil
+}
+
 func isZeroOfUnderlyingType(x interface{}) bool {
 	return reflect.DeepEqual(x, reflect.Zero(reflect.TypeOf(x)).Interface())
 }
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for a server that records the path of each request it receives
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*QuayClient, *[]string) {
+	t.Helper()
+
+	paths := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.Client(), server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, &paths
+}
+
+func TestRobotEndpoints(t *testing.T) {
+	tests := []struct {
+		name          string
+		namespaceType string
+		namespaceName string
+		robotsPath    string
+	}{
+		{
+			name:          "organization",
+			namespaceType: NamespaceTypeOrganization,
+			namespaceName: "example",
+			robotsPath:    "/api/v1/organization/example/robots",
+		},
+		{
+			name:          "user",
+			namespaceType: NamespaceTypeUser,
+			namespaceName: "alice",
+			robotsPath:    "/api/v1/user/robots",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, paths := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{}`))
+			})
+
+			ctx := context.Background()
+
+			client.GetRobotAccount(ctx, tt.namespaceType, tt.namespaceName, "build")
+			client.CreateRobotAccount(ctx, tt.namespaceType, tt.namespaceName, "build", nil)
+			client.RegenerateRobotAccountPassword(ctx, tt.namespaceType, tt.namespaceName, "build")
+			client.GetRobotPermissions(ctx, tt.namespaceType, tt.namespaceName, "build")
+			client.DeleteRobotAccount(ctx, tt.namespaceType, tt.namespaceName, "build")
+			client.UpdateRepositoryUserPermission(ctx, tt.namespaceName, "api", tt.namespaceName+"+build", "read")
+
+			expected := []string{
+				"GET " + tt.robotsPath + "/build",
+				"PUT " + tt.robotsPath + "/build",
+				"POST " + tt.robotsPath + "/build/regenerate",
+				"GET " + tt.robotsPath + "/build/permissions",
+				"DELETE " + tt.robotsPath + "/build",
+				"PUT /api/v1/repository/" + tt.namespaceName + "/api/permissions/user/" + tt.namespaceName + "+build",
+			}
+
+			if len(*paths) != len(expected) {
+				t.Fatalf("expected requests %v, got %v", expected, *paths)
+			}
+
+			for i := range expected {
+				if (*paths)[i] != expected[i] {
+					t.Fatalf("expected request '%s', got '%s'", expected[i], (*paths)[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	client, paths := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(User{Username: "alice"})
+	})
+
+	user, _, apiError := client.GetCurrentUser(context.Background())
+	if apiError.Error != nil {
+		t.Fatal(apiError.Error)
+	}
+
+	if user.Username != "alice" {
+		t.Fatalf("expected user 'alice', got '%s'", user.Username)
+	}
+
+	if (*paths)[0] != "GET /api/v1/user/" {
+		t.Fatalf("unexpected request '%s'", (*paths)[0])
+	}
+}
+
+func TestRequestContextCanceled(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, _, apiError := client.GetCurrentUser(ctx)
+	if !errors.Is(apiError.Error, context.DeadlineExceeded) {
+		t.Fatalf("expected the request to be canceled with its context, got %v", apiError.Error)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the request to return once its context is done, took %s", elapsed)
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponseError describes a non-2xx response returned by the Quay API
+type ResponseError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+}
+
+type errorResponse struct {
+	ErrorMessage string `json:"error_message"`
+	Detail       string `json:"detail"`
+	Message      string `json:"message"`
+	Error        string `json:"error"`
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// newResponseError builds a ResponseError from a non-2xx response and its body
+func newResponseError(req *http.Request, resp *http.Response, body []byte) *ResponseError {
+	responseError := &ResponseError{
+		StatusCode: resp.StatusCode,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+	}
+
+	var errorBody errorResponse
+	if err := json.Unmarshal(body, &errorBody); err == nil {
+		messages := []string{}
+		for _, message := range []string{errorBody.ErrorMessage, errorBody.Detail, errorBody.Message, errorBody.Error} {
+			if message != "" && !containsString(messages, message) {
+				messages = append(messages, message)
+			}
+		}
+		responseError.Message = strings.Join(messages, ": ")
+	} else {
+		responseError.Message = strings.TrimSpace(string(body))
+	}
+
+	return responseError
+}
+
+// StatusCode returns the HTTP status code of a ResponseError or 0 if err is not a ResponseError
+func StatusCode(err error) int {
+	var responseError *ResponseError
+	if errors.As(err, &responseError) {
+		return responseError.StatusCode
+	}
+
+	return 0
+}
+
+// IsBadRequest returns whether err is a 400 response from the Quay API
+func IsBadRequest(err error) bool {
+	return StatusCode(err) == http.StatusBadRequest
+}
+
+// IsUnauthorized returns whether err is a 401 response from the Quay API
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden returns whether err is a 403 response from the Quay API
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// IsNotFound returns whether err is a 404 response from the Quay API
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantMessage string
+		wantError   string
+	}{
+		{
+			name:        "error message",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"error_message": "Could not find robot with specified username"}`,
+			wantMessage: "Could not find robot with specified username",
+			wantError:   "GET /api/v1/user/: 400 Bad Request: Could not find robot with specified username",
+		},
+		{
+			name:        "duplicate messages",
+			statusCode:  http.StatusNotFound,
+			body:        `{"error_message": "Not Found", "detail": "Not Found", "message": "Team does not exist"}`,
+			wantMessage: "Not Found: Team does not exist",
+			wantError:   "GET /api/v1/user/: 404 Not Found: Not Found: Team does not exist",
+		},
+		{
+			name:        "plain text",
+			statusCode:  http.StatusBadGateway,
+			body:        "upstream unavailable\n",
+			wantMessage: "upstream unavailable",
+			wantError:   "GET /api/v1/user/: 502 Bad Gateway: upstream unavailable",
+		},
+		{
+			name:       "empty body",
+			statusCode: http.StatusForbidden,
+			wantError:  "GET /api/v1/user/: 403 Forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			})
+			client.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+			_, _, apiError := client.GetCurrentUser(context.Background())
+
+			var responseError *ResponseError
+			if !errors.As(apiError.Error, &responseError) {
+				t.Fatalf("expected a *ResponseError, got %v", apiError.Error)
+			}
+
+			if responseError.StatusCode != tt.statusCode || responseError.Method != http.MethodGet || responseError.Path != "/api/v1/user/" {
+				t.Fatalf("unexpected response error %+v", responseError)
+			}
+
+			if responseError.Message != tt.wantMessage {
+				t.Fatalf("expected message '%s', got '%s'", tt.wantMessage, responseError.Message)
+			}
+
+			if responseError.Error() != tt.wantError {
+				t.Fatalf("expected error '%s', got '%s'", tt.wantError, responseError.Error())
+			}
+		})
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	responseError := &ResponseError{StatusCode: http.StatusNotFound}
+	wrapped := fmt.Errorf("error reading robot account: %w", responseError)
+
+	if StatusCode(wrapped) != http.StatusNotFound || !IsNotFound(wrapped) {
+		t.Fatal("expected a wrapped 404 response error to be found")
+	}
+
+	if IsBadRequest(wrapped) || IsUnauthorized(wrapped) || IsForbidden(wrapped) {
+		t.Fatal("expected a 404 response error to match only IsNotFound")
+	}
+
+	if StatusCode(errors.New("connection refused")) != 0 || IsNotFound(nil) {
+		t.Fatal("expected errors other than response errors to have no status code")
+	}
+}
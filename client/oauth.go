@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+// NewSessionClient returns a client that authenticates by signing in to Quay as a user. A session is
+// required to authorize OAuth applications on behalf of the user and to manage the authorizations of the user
+func NewSessionClient(httpClient *http.Client, baseUrl string) (*QuayClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionHTTPClient := *httpClient
+	sessionHTTPClient.Jar = jar
+
+	// Authorizing an application redirects to the redirect URI of the application with the authorization code
+	sessionHTTPClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return NewClient(&sessionHTTPClient, baseUrl, "")
+}
+
+// SignIn starts a session as the given user
+func (c *QuayClient) SignIn(ctx context.Context, username string, password string) (*http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "GET", "/csrf_token", nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	var csrfTokenResponse CSRFTokenResponse
+	resp, err := c.do(req, &csrfTokenResponse)
+	if err != nil {
+		return resp, QuayApiError{Error: err}
+	}
+
+	c.csrfToken = csrfTokenResponse.CSRFToken
+
+	req, err = c.newRequest(ctx, "POST", "/api/v1/signin", &SignInRequest{
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	var signInResponse SignInResponse
+	resp, err = c.do(req, &signInResponse)
+	if err != nil {
+		return resp, QuayApiError{Error: err}
+	}
+
+	if !signInResponse.Success {
+		return resp, QuayApiError{Error: fmt.Errorf("error signing in as '%s': %s", username, signInResponse.Message)}
+	}
+
+	return resp, QuayApiError{}
+}
+
+// AuthorizeApplication authorizes an OAuth application on behalf of the signed in user and returns the
+// authorization code that the application exchanges for an access token
+func (c *QuayClient) AuthorizeApplication(ctx context.Context, clientID string, redirectURI string, scopes []string) (string, *http.Response, QuayApiError) {
+
+	req, err := c.newFormRequest(ctx, "/oauth/authorizeapp", url.Values{
+		"client_id":     {clientID},
+		"redirect_uri":  {redirectURI},
+		"scope":         {strings.Join(scopes, " ")},
+		"response_type": {"code"},
+		"_csrf_token":   {c.csrfToken},
+	})
+	if err != nil {
+		return "", nil, QuayApiError{Error: err}
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return "", nil, QuayApiError{Error: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		responseData, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", resp, QuayApiError{Error: err}
+		}
+
+		return "", resp, QuayApiError{Error: newResponseError(req, resp, responseData)}
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", resp, QuayApiError{Error: fmt.Errorf("error authorizing application: %w", err)}
+	}
+
+	query := location.Query()
+	if authorizationError := query.Get("error"); authorizationError != "" {
+		return "", resp, QuayApiError{Error: fmt.Errorf("error authorizing application: %s", authorizationError)}
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return "", resp, QuayApiError{Error: fmt.Errorf("no authorization code returned when authorizing application")}
+	}
+
+	return code, resp, QuayApiError{}
+}
+
+// ExchangeAuthorizationCode exchanges an authorization code for an access token
+func (c *QuayClient) ExchangeAuthorizationCode(ctx context.Context, clientID string, clientSecret string, redirectURI string, code string) (AccessTokenResponse, *http.Response, QuayApiError) {
+
+	req, err := c.newFormRequest(ctx, "/oauth/access_token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"redirect_uri":  {redirectURI},
+	})
+	if err != nil {
+		return AccessTokenResponse{}, nil, QuayApiError{Error: err}
+	}
+	var accessTokenResponse AccessTokenResponse
+	resp, err := c.do(req, &accessTokenResponse)
+
+	return accessTokenResponse, resp, QuayApiError{Error: err}
+}
+
+// GetAuthorizations returns the access tokens issued to OAuth applications on behalf of the user
+func (c *QuayClient) GetAuthorizations(ctx context.Context) ([]Authorization, *http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "GET", "/api/v1/user/authorizations", nil)
+	if err != nil {
+		return nil, nil, QuayApiError{Error: err}
+	}
+	var authorizationsResponse AuthorizationsResponse
+	resp, err := c.do(req, &authorizationsResponse)
+
+	return authorizationsResponse.Authorizations, resp, QuayApiError{Error: err}
+}
+
+// DeleteAuthorization revokes an access token issued to an OAuth application
+func (c *QuayClient) DeleteAuthorization(ctx context.Context, authorizationUUID string) (*http.Response, QuayApiError) {
+
+	req, err := c.newRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/user/authorizations/%s", authorizationUUID), nil)
+	if err != nil {
+		return nil, QuayApiError{Error: err}
+	}
+	resp, err := c.do(req, nil)
+
+	return resp, QuayApiError{Error: err}
+}
+
+func (c *QuayClient) newFormRequest(ctx context.Context, path string, form url.Values) (*http.Request, error) {
+	rel, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL.ResolveReference(rel).String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	c.authenticate(req)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
@@ -0,0 +1,1219 @@
+// Package quaytest provides an in-memory fake of the Quay API for use in tests
+package quaytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	apiPrefix     = "/api/v1/"
+	sessionCookie = "_session"
+)
+
+// Server is a fake Quay server. The zero value is not usable, use NewServer
+type Server struct {
+	*httptest.Server
+
+	lock           sync.Mutex
+	token          string
+	username       string
+	password       string
+	namespaces     map[string]*namespace
+	applications   map[string]*application
+	authorizations map[string]*authorization
+	appTokens      map[string]*qc.ApplicationToken
+	codes          map[string]*authorization
+	sessions       map[string]*session
+	requests       []string
+	failures       []*Failure
+	pageSize       int
+	prototypeID    int
+	tokenID        int
+}
+
+// Failure describes an error returned in place of handling the requests it matches
+type Failure struct {
+	// Method of the requests to fail. Requests of any method are failed when empty
+	Method string
+	// Path is a pattern, as used by path.Match, matched against the path of requests
+	Path string
+	// StatusCode is the status of the error response
+	StatusCode int
+	// Count is the number of requests to fail. Requests are failed until the failure is cleared when zero
+	Count int
+}
+
+type application struct {
+	clientSecret string
+	redirectURI  string
+}
+
+// authorization is an OAuth token issued to an application on behalf of the authenticated user
+type authorization struct {
+	qc.Authorization
+	token string
+}
+
+type session struct {
+	csrfToken string
+	signedIn  bool
+}
+
+type namespace struct {
+	organization bool
+	robots       map[string]*qc.RobotAccount
+	teams        map[string]*team
+	prototypes   []qc.Prototype
+	repositories map[string]*repository
+}
+
+type team struct {
+	qc.Team
+	members map[string]bool
+}
+
+type repository struct {
+	qc.Repository
+	userPermissions map[string]qc.QuayPermission
+	teamPermissions map[string]qc.QuayPermission
+}
+
+// NewServer starts a fake Quay server accepting the given token on behalf of the given user
+func NewServer(username string, token string) *Server {
+	s := NewUnstartedServer(username, token)
+	s.Start()
+
+	return s
+}
+
+// NewUnstartedServer returns a fake Quay server that is not started so that its listener can be replaced
+func NewUnstartedServer(username string, token string) *Server {
+	s := &Server{
+		token:          token,
+		username:       username,
+		namespaces:     map[string]*namespace{},
+		applications:   map[string]*application{},
+		authorizations: map[string]*authorization{},
+		appTokens:      map[string]*qc.ApplicationToken{},
+		codes:          map[string]*authorization{},
+		sessions:       map[string]*session{},
+	}
+
+	s.namespaces[username] = newNamespace(false)
+
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+func newNamespace(organization bool) *namespace {
+	return &namespace{
+		organization: organization,
+		robots:       map[string]*qc.RobotAccount{},
+		teams:        map[string]*team{},
+		repositories: map[string]*repository{},
+	}
+}
+
+// AddOrganization creates an organization
+func (s *Server) AddOrganization(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.namespaces[name]; !ok {
+		s.namespaces[name] = newNamespace(true)
+	}
+}
+
+// AddUser creates a user other than the authenticated user
+func (s *Server) AddUser(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.namespaces[name]; !ok {
+		s.namespaces[name] = newNamespace(false)
+	}
+}
+
+// AddRobot creates a robot account within a user or an organization and returns it
+func (s *Server) AddRobot(namespaceName string, robotName string) qc.RobotAccount {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns := s.namespace(namespaceName)
+
+	robot := &qc.RobotAccount{
+		Name:    fmt.Sprintf("%s+%s", namespaceName, robotName),
+		Created: time.Now().UTC().Format(time.RFC1123Z),
+		Token:   s.newToken(),
+	}
+	ns.robots[robotName] = robot
+
+	return *robot
+}
+
+// AddTeam creates or updates a team within an organization
+func (s *Server) AddTeam(organizationName string, teamName string, role qc.QuayTeamRole, description string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns := s.namespace(organizationName)
+
+	t, ok := ns.teams[teamName]
+	if !ok {
+		t = &team{members: map[string]bool{}}
+		ns.teams[teamName] = t
+	}
+
+	t.Team = qc.Team{Name: teamName, Role: role, Description: description}
+}
+
+// AddTeamMember adds a user or a robot account, identified by its full name, to a team
+func (s *Server) AddTeamMember(organizationName string, teamName string, memberName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if t, ok := s.namespace(organizationName).teams[teamName]; ok {
+		t.members[memberName] = true
+	}
+}
+
+// AddRepository creates a repository within a user or an organization
+func (s *Server) AddRepository(namespaceName string, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns := s.namespace(namespaceName)
+
+	ns.repositories[name] = &repository{
+		Repository:      qc.Repository{Name: name},
+		userPermissions: map[string]qc.QuayPermission{},
+		teamPermissions: map[string]qc.QuayPermission{},
+	}
+}
+
+// SetPassword sets the password the authenticated user signs in with
+func (s *Server) SetPassword(password string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.password = password
+}
+
+// AddOAuthApplication registers an OAuth application that the authenticated user can authorize
+func (s *Server) AddOAuthApplication(clientID string, clientSecret string, redirectURI string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.applications[clientID] = &application{clientSecret: clientSecret, redirectURI: redirectURI}
+}
+
+// AuthorizeApplication issues a token to an OAuth application on behalf of the authenticated user
+// and returns the token along with the UUID of its authorization
+func (s *Server) AuthorizeApplication(clientID string) (string, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	authorization := s.newAuthorization(clientID, nil)
+	s.authorizations[authorization.UUID] = authorization
+
+	return authorization.token, authorization.UUID
+}
+
+// AddApplicationToken creates an application token of the authenticated user and returns the token along with its UUID
+func (s *Server) AddApplicationToken(title string) (string, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	appToken := s.newApplicationToken(title)
+	s.appTokens[appToken.UUID] = appToken
+
+	return appToken.TokenCode, appToken.UUID
+}
+
+// SetRepositoryPermission sets the permission a user or robot account holds on a repository, as when changed outside of Vault.
+// The permission is removed when empty
+func (s *Server) SetRepositoryPermission(namespaceName string, repositoryName string, username string, permission qc.QuayPermission) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	repo, ok := s.namespace(namespaceName).repositories[repositoryName]
+	if !ok {
+		return
+	}
+
+	if permission == "" {
+		delete(repo.userPermissions, username)
+	} else {
+		repo.userPermissions[username] = permission
+	}
+}
+
+// RemoveTeamMember removes a user or a robot account, identified by its full name, from a team
+func (s *Server) RemoveTeamMember(organizationName string, teamName string, memberName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if t, ok := s.namespace(organizationName).teams[teamName]; ok {
+		delete(t.members, memberName)
+	}
+}
+
+// SetRobotCreated sets when a robot account was created
+func (s *Server) SetRobotCreated(namespaceName string, robotName string, created time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if robot, ok := s.namespace(namespaceName).robots[robotName]; ok {
+		robot.Created = created.UTC().Format(time.RFC1123Z)
+	}
+}
+
+// SetRobotLastAccessed sets when a robot account was last used
+func (s *Server) SetRobotLastAccessed(namespaceName string, robotName string, lastAccessed time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if robot, ok := s.namespace(namespaceName).robots[robotName]; ok {
+		robot.LastAccessed = lastAccessed.UTC().Format(time.RFC1123Z)
+	}
+}
+
+// SetPageSize limits the number of items returned by paginated endpoints. Pagination is disabled when zero
+func (s *Server) SetPageSize(pageSize int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pageSize = pageSize
+}
+
+// InjectFailure fails the requests matching a failure until it is cleared or its count is exhausted
+func (s *Server) InjectFailure(failure Failure) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = append(s.failures, &failure)
+}
+
+// ClearFailures removes every injected failure
+func (s *Server) ClearFailures() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = nil
+}
+
+// Robot returns a robot account identified by its namespace and short name
+func (s *Server) Robot(namespaceName string, robotName string) (qc.RobotAccount, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ns, ok := s.namespaces[namespaceName]; ok {
+		if robot, ok := ns.robots[robotName]; ok {
+			return *robot, true
+		}
+	}
+
+	return qc.RobotAccount{}, false
+}
+
+// Robots returns the short names of the robot accounts within a namespace
+func (s *Server) Robots(namespaceName string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	robotNames := []string{}
+
+	if ns, ok := s.namespaces[namespaceName]; ok {
+		for robotName := range ns.robots {
+			robotNames = append(robotNames, robotName)
+		}
+	}
+
+	sort.Strings(robotNames)
+
+	return robotNames
+}
+
+// Repository returns a repository identified by its namespace and name
+func (s *Server) Repository(namespaceName string, repositoryName string) (qc.Repository, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ns, ok := s.namespaces[namespaceName]; ok {
+		if repo, ok := ns.repositories[repositoryName]; ok {
+			return repo.Repository, true
+		}
+	}
+
+	return qc.Repository{}, false
+}
+
+// RepositoryPermissions returns the permissions users and robot accounts hold on a repository
+func (s *Server) RepositoryPermissions(namespaceName string, repositoryName string) map[string]qc.QuayPermission {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	permissions := map[string]qc.QuayPermission{}
+
+	if ns, ok := s.namespaces[namespaceName]; ok {
+		if repo, ok := ns.repositories[repositoryName]; ok {
+			for name, permission := range repo.userPermissions {
+				permissions[name] = permission
+			}
+		}
+	}
+
+	return permissions
+}
+
+// TeamMembers returns the members of a team and whether the team exists
+func (s *Server) TeamMembers(organizationName string, teamName string) ([]string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns, ok := s.namespaces[organizationName]
+	if !ok {
+		return nil, false
+	}
+
+	t, ok := ns.teams[teamName]
+	if !ok {
+		return nil, false
+	}
+
+	members := []string{}
+	for member := range t.members {
+		members = append(members, member)
+	}
+
+	sort.Strings(members)
+
+	return members, true
+}
+
+// Prototypes returns the default permissions of an organization
+func (s *Server) Prototypes(organizationName string) []qc.Prototype {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ns, ok := s.namespaces[organizationName]; ok {
+		return append([]qc.Prototype{}, ns.prototypes...)
+	}
+
+	return nil
+}
+
+// Authorizations returns the authorizations of the tokens issued to OAuth applications
+func (s *Server) Authorizations() []qc.Authorization {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	authorizations := []qc.Authorization{}
+	for _, uuid := range sortedKeys(s.authorizations) {
+		authorizations = append(authorizations, s.authorizations[uuid].Authorization)
+	}
+
+	return authorizations
+}
+
+// ApplicationTokens returns the application tokens of the authenticated user without their token codes
+func (s *Server) ApplicationTokens() []qc.ApplicationToken {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	appTokens := []qc.ApplicationToken{}
+	for _, uuid := range sortedKeys(s.appTokens) {
+		appToken := *s.appTokens[uuid]
+		appToken.TokenCode = ""
+		appTokens = append(appTokens, appToken)
+	}
+
+	return appTokens
+}
+
+// Requests returns the requests received by the server formatted as "<method> <path>"
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+	if failure := s.matchFailure(r); failure != nil {
+		writeError(w, failure.StatusCode, "injected failure")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/csrf_token" && r.Method == http.MethodGet:
+		s.serveCSRFToken(w, r)
+		return
+	case r.URL.Path == apiPrefix+"signin" && r.Method == http.MethodPost:
+		s.serveSignIn(w, r)
+		return
+	case r.URL.Path == "/oauth/authorizeapp" && r.Method == http.MethodPost:
+		s.serveAuthorizeApp(w, r)
+		return
+	case r.URL.Path == "/oauth/access_token" && r.Method == http.MethodPost:
+		s.serveAccessToken(w, r)
+		return
+	}
+
+	if !s.authenticated(r) {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+
+	switch {
+	case len(segments) == 1 && segments[0] == "user" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, qc.User{Username: s.username})
+	case len(segments) >= 2 && segments[0] == "user" && segments[1] == "authorizations":
+		s.serveAuthorizations(w, r, segments[2:])
+	case len(segments) >= 2 && segments[0] == "user" && segments[1] == "apptoken":
+		s.serveApplicationTokens(w, r, segments[2:])
+	case len(segments) >= 2 && segments[0] == "user" && segments[1] == "robots":
+		s.serveRobots(w, r, s.username, segments[2:])
+	case len(segments) >= 3 && segments[0] == "organization" && segments[2] == "robots":
+		s.serveRobots(w, r, segments[1], segments[3:])
+	case len(segments) >= 2 && segments[0] == "organization":
+		s.serveOrganization(w, r, segments[1], segments[2:])
+	case len(segments) == 1 && segments[0] == "repository" && r.Method == http.MethodGet:
+		s.serveRepositories(w, r)
+	case len(segments) == 1 && segments[0] == "repository" && r.Method == http.MethodPost:
+		s.serveRepositoryCreate(w, r)
+	case len(segments) == 6 && segments[0] == "repository" && segments[3] == "permissions":
+		s.serveRepositoryPermission(w, r, segments[1], segments[2], segments[4], segments[5])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// authenticated returns whether a request carries a valid token, the credentials of a robot account or belongs
+// to a signed in session. Requests other than GET made using a session must include the CSRF token of the session
+func (s *Server) authenticated(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == s.token {
+			return true
+		}
+
+		for _, authorization := range s.authorizations {
+			if authorization.token == token {
+				return true
+			}
+		}
+
+		for _, appToken := range s.appTokens {
+			if appToken.TokenCode == token {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		return s.robotCredentialsValid(username, password)
+	}
+
+	sess := s.session(r)
+
+	return sess != nil && sess.signedIn && (r.Method == http.MethodGet || r.Header.Get("X-CSRF-Token") == sess.csrfToken)
+}
+
+func (s *Server) session(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	return s.sessions[cookie.Value]
+}
+
+func (s *Server) serveCSRFToken(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	if sess == nil {
+		sess = &session{csrfToken: s.newToken()}
+
+		sessionID := s.newToken()
+		s.sessions[sessionID] = sess
+
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: sessionID, Path: "/"})
+	}
+
+	writeJSON(w, http.StatusOK, qc.CSRFTokenResponse{CSRFToken: sess.csrfToken})
+}
+
+func (s *Server) serveSignIn(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	if sess == nil || r.Header.Get("X-CSRF-Token") != sess.csrfToken {
+		writeError(w, http.StatusForbidden, "invalid CSRF token")
+		return
+	}
+
+	var signInRequest qc.SignInRequest
+	if err := json.NewDecoder(r.Body).Decode(&signInRequest); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.password == "" || signInRequest.Username != s.username || signInRequest.Password != s.password {
+		writeJSON(w, http.StatusForbidden, qc.SignInResponse{Message: "Invalid username or password"})
+		return
+	}
+
+	sess.signedIn = true
+
+	writeJSON(w, http.StatusOK, qc.SignInResponse{Success: true})
+}
+
+func (s *Server) serveAuthorizeApp(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(r)
+	if sess == nil || !sess.signedIn || r.PostFormValue("_csrf_token") != sess.csrfToken {
+		writeError(w, http.StatusForbidden, "invalid CSRF token")
+		return
+	}
+
+	clientID := r.PostFormValue("client_id")
+	app, ok := s.applications[clientID]
+	if !ok || r.PostFormValue("redirect_uri") != app.redirectURI || r.PostFormValue("response_type") != "code" {
+		writeError(w, http.StatusBadRequest, "invalid authorization request")
+		return
+	}
+
+	code := s.newToken()
+	s.codes[code] = s.newAuthorization(clientID, strings.Fields(r.PostFormValue("scope")))
+
+	http.Redirect(w, r, fmt.Sprintf("%s?code=%s", app.redirectURI, code), http.StatusFound)
+}
+
+func (s *Server) serveAccessToken(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PostFormValue("client_id")
+	app, ok := s.applications[clientID]
+	if !ok || r.PostFormValue("client_secret") != app.clientSecret || r.PostFormValue("redirect_uri") != app.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	authorization, ok := s.codes[code]
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || authorization.Application.ClientID != clientID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	delete(s.codes, code)
+	s.authorizations[authorization.UUID] = authorization
+
+	scopes := []string{}
+	for _, scope := range authorization.Scopes {
+		scopes = append(scopes, scope.Scope)
+	}
+
+	writeJSON(w, http.StatusOK, qc.AccessTokenResponse{AccessToken: authorization.token, TokenType: "Bearer", Scope: strings.Join(scopes, " ")})
+}
+
+func (s *Server) serveAuthorizations(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		authorizations := []qc.Authorization{}
+		for _, uuid := range sortedKeys(s.authorizations) {
+			authorizations = append(authorizations, s.authorizations[uuid].Authorization)
+		}
+
+		writeJSON(w, http.StatusOK, qc.AuthorizationsResponse{Authorizations: authorizations})
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		if _, ok := s.authorizations[segments[0]]; !ok {
+			writeError(w, http.StatusNotFound, "authorization not found")
+			return
+		}
+
+		delete(s.authorizations, segments[0])
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveApplicationTokens(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		var appTokenRequest qc.ApplicationTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&appTokenRequest); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		appToken := s.newApplicationToken(appTokenRequest.Title)
+		s.appTokens[appToken.UUID] = appToken
+
+		writeJSON(w, http.StatusOK, qc.ApplicationTokenResponse{Token: *appToken})
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		if _, ok := s.appTokens[segments[0]]; !ok {
+			writeError(w, http.StatusNotFound, "application token not found")
+			return
+		}
+
+		delete(s.appTokens, segments[0])
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveRobots(w http.ResponseWriter, r *http.Request, namespaceName string, segments []string) {
+	ns, ok := s.namespaces[namespaceName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "namespace not found")
+		return
+	}
+
+	if len(segments) == 0 && r.Method == http.MethodGet {
+		s.serveRobotList(w, r, ns)
+		return
+	}
+
+	robotName := segments[0]
+	robotAccountName := fmt.Sprintf("%s+%s", namespaceName, robotName)
+	robot, exists := ns.robots[robotName]
+
+	switch {
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		if !exists {
+			writeError(w, http.StatusBadRequest, "Could not find robot with specified username")
+			return
+		}
+		writeJSON(w, http.StatusOK, robot)
+	case len(segments) == 1 && r.Method == http.MethodPut:
+		if exists {
+			writeError(w, http.StatusBadRequest, "Existing robot with name: "+robotAccountName)
+			return
+		}
+
+		var robotAccountRequest qc.RobotAccountRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&robotAccountRequest); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		robot = &qc.RobotAccount{
+			Name:                 robotAccountName,
+			Description:          robotAccountRequest.Description,
+			UnstructuredMetadata: robotAccountRequest.UnstructuredMetadata,
+			Created:              time.Now().UTC().Format(time.RFC1123Z),
+			Token:                s.newToken(),
+		}
+		ns.robots[robotName] = robot
+
+		writeJSON(w, http.StatusCreated, robot)
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		if !exists {
+			writeError(w, http.StatusBadRequest, "Could not find robot with specified username")
+			return
+		}
+
+		delete(ns.robots, robotName)
+		s.removeMember(robotAccountName)
+
+		w.WriteHeader(http.StatusNoContent)
+	case len(segments) == 2 && segments[1] == "regenerate" && r.Method == http.MethodPost:
+		if !exists {
+			writeError(w, http.StatusBadRequest, "Could not find robot with specified username")
+			return
+		}
+
+		robot.Token = s.newToken()
+
+		writeJSON(w, http.StatusOK, robot)
+	case len(segments) == 2 && segments[1] == "permissions" && r.Method == http.MethodGet:
+		if !exists {
+			writeError(w, http.StatusBadRequest, "Could not find robot with specified username")
+			return
+		}
+
+		permissions := []qc.Permission{}
+		for _, repositoryName := range sortedKeys(ns.repositories) {
+			repo := ns.repositories[repositoryName]
+			if permission, ok := repo.userPermissions[robotAccountName]; ok {
+				permissions = append(permissions, qc.Permission{Repository: repo.Repository, Role: permission})
+			}
+		}
+
+		writeJSON(w, http.StatusOK, qc.PermissionsResponse{Permissions: permissions})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveRobotList(w http.ResponseWriter, r *http.Request, ns *namespace) {
+	query := r.URL.Query()
+	robotNames := sortedKeys(ns.robots)
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	start, end, nextPage, ok := s.page(r, len(robotNames), limit)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid next_page")
+		return
+	}
+
+	response := qc.RobotAccountsResponse{Robots: []qc.RobotAccount{}, NextPage: nextPage}
+
+	for _, robotName := range robotNames[start:end] {
+		robot := *ns.robots[robotName]
+
+		if query.Get("token") != "true" {
+			robot.Token = ""
+		}
+
+		if query.Get("permissions") == "true" {
+			robot.Teams = []qc.RobotTeam{}
+			for _, teamName := range sortedKeys(ns.teams) {
+				if ns.teams[teamName].members[robot.Name] {
+					robot.Teams = append(robot.Teams, qc.RobotTeam{Name: teamName})
+				}
+			}
+
+			robot.Repositories = []string{}
+			for _, repositoryName := range sortedKeys(ns.repositories) {
+				if _, ok := ns.repositories[repositoryName].userPermissions[robot.Name]; ok {
+					robot.Repositories = append(robot.Repositories, repositoryName)
+				}
+			}
+		}
+
+		response.Robots = append(response.Robots, robot)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) serveOrganization(w http.ResponseWriter, r *http.Request, organizationName string, segments []string) {
+	ns, ok := s.namespaces[organizationName]
+	if !ok || !ns.organization {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		teams := map[string]qc.Team{}
+		for teamName, t := range ns.teams {
+			teams[teamName] = t.Team
+		}
+
+		writeJSON(w, http.StatusOK, qc.Organization{Name: organizationName, Teams: teams})
+	case len(segments) >= 2 && segments[0] == "team":
+		s.serveTeam(w, r, ns, segments[1], segments[2:])
+	case len(segments) == 1 && segments[0] == "prototypes" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, qc.PrototypesResponse{Prototypes: append([]qc.Prototype{}, ns.prototypes...)})
+	case len(segments) == 1 && segments[0] == "prototypes" && r.Method == http.MethodPost:
+		var prototype qc.Prototype
+		if err := json.NewDecoder(r.Body).Decode(&prototype); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		s.prototypeID++
+		prototype.ID = strconv.Itoa(s.prototypeID)
+		ns.prototypes = append(ns.prototypes, prototype)
+
+		writeJSON(w, http.StatusOK, prototype)
+	case len(segments) == 2 && segments[0] == "prototypes" && r.Method == http.MethodDelete:
+		for i, prototype := range ns.prototypes {
+			if prototype.ID == segments[1] {
+				ns.prototypes = append(ns.prototypes[:i], ns.prototypes[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		writeError(w, http.StatusNotFound, "prototype not found")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveTeam(w http.ResponseWriter, r *http.Request, ns *namespace, teamName string, segments []string) {
+	t, exists := ns.teams[teamName]
+
+	if !exists && !(len(segments) == 0 && r.Method == http.MethodPut) {
+		writeError(w, http.StatusNotFound, "team not found")
+		return
+	}
+
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodPut:
+		var teamRequest qc.Team
+		if err := json.NewDecoder(r.Body).Decode(&teamRequest); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if !exists {
+			t = &team{members: map[string]bool{}}
+			ns.teams[teamName] = t
+		}
+
+		t.Team = qc.Team{Name: teamName, Role: teamRequest.Role, Description: teamRequest.Description}
+
+		writeJSON(w, http.StatusOK, t.Team)
+	case len(segments) == 0 && r.Method == http.MethodDelete:
+		delete(ns.teams, teamName)
+
+		for _, repo := range ns.repositories {
+			delete(repo.teamPermissions, teamName)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case len(segments) == 1 && segments[0] == "members" && r.Method == http.MethodGet:
+		members := []qc.TeamMember{}
+		for _, member := range sortedKeys(t.members) {
+			members = append(members, qc.TeamMember{Name: member, Kind: "user", Robot: strings.Contains(member, "+")})
+		}
+
+		writeJSON(w, http.StatusOK, qc.TeamMembersResponse{Members: members})
+	case len(segments) == 2 && segments[0] == "members" && r.Method == http.MethodPut:
+		if !s.memberExists(segments[1]) {
+			writeError(w, http.StatusBadRequest, "Unknown user or robot: "+segments[1])
+			return
+		}
+
+		t.members[segments[1]] = true
+
+		writeJSON(w, http.StatusOK, qc.TeamMember{Name: segments[1], Kind: "user"})
+	case len(segments) == 2 && segments[0] == "members" && r.Method == http.MethodDelete:
+		if !t.members[segments[1]] {
+			writeError(w, http.StatusNotFound, "member not found")
+			return
+		}
+
+		delete(t.members, segments[1])
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveRepositories(w http.ResponseWriter, r *http.Request) {
+	ns, ok := s.namespaces[r.URL.Query().Get("namespace")]
+	if !ok {
+		writeJSON(w, http.StatusOK, qc.RepositoriesResponse{Repositories: []qc.Repository{}})
+		return
+	}
+
+	repositoryNames := sortedKeys(ns.repositories)
+
+	start, end, nextPage, ok := s.page(r, len(repositoryNames), 0)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid next_page")
+		return
+	}
+
+	response := qc.RepositoriesResponse{Repositories: []qc.Repository{}, NextPage: nextPage}
+	for _, repositoryName := range repositoryNames[start:end] {
+		response.Repositories = append(response.Repositories, ns.repositories[repositoryName].Repository)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) serveRepositoryCreate(w http.ResponseWriter, r *http.Request) {
+	var repositoryCreateRequest qc.RepositoryCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&repositoryCreateRequest); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ns, ok := s.namespaces[repositoryCreateRequest.Namespace]
+	if !ok {
+		writeError(w, http.StatusNotFound, "namespace not found")
+		return
+	}
+
+	if repositoryCreateRequest.Visibility != "public" && repositoryCreateRequest.Visibility != "private" {
+		writeError(w, http.StatusBadRequest, "Invalid visibility: "+repositoryCreateRequest.Visibility)
+		return
+	}
+
+	if _, ok := ns.repositories[repositoryCreateRequest.Repository]; ok {
+		writeError(w, http.StatusBadRequest, "Repository already exists")
+		return
+	}
+
+	repo := &repository{
+		Repository: qc.Repository{
+			Name:        repositoryCreateRequest.Repository,
+			Public:      repositoryCreateRequest.Visibility == "public",
+			Description: repositoryCreateRequest.Description,
+		},
+		userPermissions: map[string]qc.QuayPermission{},
+		teamPermissions: map[string]qc.QuayPermission{},
+	}
+	ns.repositories[repositoryCreateRequest.Repository] = repo
+
+	writeJSON(w, http.StatusCreated, repo.Repository)
+}
+
+// page returns the bounds of the page of items requested and the token of the next page. The token
+// of a page is the index of its first item. Pages hold at most limit items, or the page size of the
+// server when limit is zero
+func (s *Server) page(r *http.Request, total int, limit int) (int, int, *string, bool) {
+	start := 0
+	if nextPage := r.URL.Query().Get("next_page"); nextPage != "" {
+		var err error
+		if start, err = strconv.Atoi(nextPage); err != nil || start < 0 || start > total {
+			return 0, 0, nil, false
+		}
+	}
+
+	if limit <= 0 || (s.pageSize > 0 && s.pageSize < limit) {
+		limit = s.pageSize
+	}
+
+	end := total
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	if end < total {
+		nextPage := strconv.Itoa(end)
+		return start, end, &nextPage, true
+	}
+
+	return start, end, nil, true
+}
+
+func (s *Server) serveRepositoryPermission(w http.ResponseWriter, r *http.Request, namespaceName string, repositoryName string, kind string, name string) {
+	ns, ok := s.namespaces[namespaceName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "namespace not found")
+		return
+	}
+
+	repo, ok := ns.repositories[repositoryName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	var permissions map[string]qc.QuayPermission
+
+	switch kind {
+	case "user":
+		if !s.memberExists(name) {
+			writeError(w, http.StatusBadRequest, "Unknown user or robot: "+name)
+			return
+		}
+		permissions = repo.userPermissions
+	case "team":
+		if _, ok := ns.teams[name]; !ok {
+			writeError(w, http.StatusBadRequest, "Unknown team: "+name)
+			return
+		}
+		permissions = repo.teamPermissions
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var permissionRequest qc.PermissionUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&permissionRequest); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		permissions[name] = qc.QuayPermission(permissionRequest.Role)
+
+		writeJSON(w, http.StatusOK, map[string]string{"name": name, "role": permissionRequest.Role})
+	case http.MethodDelete:
+		if _, ok := permissions[name]; !ok {
+			writeError(w, http.StatusNotFound, "permission not found")
+			return
+		}
+
+		delete(permissions, name)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// namespace returns a namespace, creating an organization if it does not exist. The caller must hold the lock
+func (s *Server) namespace(namespaceName string) *namespace {
+	ns, ok := s.namespaces[namespaceName]
+	if !ok {
+		ns = newNamespace(true)
+		s.namespaces[namespaceName] = ns
+	}
+
+	return ns
+}
+
+// matchFailure returns the injected failure matching a request, consuming one of its occurrences.
+// The caller must hold the lock
+func (s *Server) matchFailure(r *http.Request) *Failure {
+	for i, failure := range s.failures {
+		if failure.Method != "" && failure.Method != r.Method {
+			continue
+		}
+
+		if matched, _ := path.Match(failure.Path, r.URL.Path); !matched {
+			continue
+		}
+
+		if failure.Count > 0 {
+			failure.Count--
+			if failure.Count == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+
+		return failure
+	}
+
+	return nil
+}
+
+// memberExists returns whether a user or a robot account, identified by its full name, exists
+func (s *Server) memberExists(name string) bool {
+	parts := strings.SplitN(name, "+", 2)
+
+	ns, ok := s.namespaces[parts[0]]
+	if !ok {
+		return false
+	}
+
+	if len(parts) == 1 {
+		return !ns.organization
+	}
+
+	_, ok = ns.robots[parts[1]]
+
+	return ok
+}
+
+// removeMember removes a deleted robot account from teams, prototypes and repository permissions
+func (s *Server) removeMember(name string) {
+	for _, ns := range s.namespaces {
+		for _, t := range ns.teams {
+			delete(t.members, name)
+		}
+
+		prototypes := []qc.Prototype{}
+		for _, prototype := range ns.prototypes {
+			if prototype.Delegate.Name != name {
+				prototypes = append(prototypes, prototype)
+			}
+		}
+		ns.prototypes = prototypes
+
+		for _, repo := range ns.repositories {
+			delete(repo.userPermissions, name)
+		}
+	}
+}
+
+func (s *Server) newAuthorization(clientID string, scopes []string) *authorization {
+	authorization := &authorization{
+		Authorization: qc.Authorization{
+			UUID:        fmt.Sprintf("authorization-%s", s.newToken()),
+			Application: qc.AuthorizationApplication{ClientID: clientID, Name: clientID},
+			Scopes:      []qc.AuthorizationScope{},
+		},
+		token: s.newToken(),
+	}
+
+	for _, scope := range scopes {
+		authorization.Scopes = append(authorization.Scopes, qc.AuthorizationScope{Scope: scope})
+	}
+
+	return authorization
+}
+
+func (s *Server) newApplicationToken(title string) *qc.ApplicationToken {
+	return &qc.ApplicationToken{
+		UUID:      fmt.Sprintf("apptoken-%s", s.newToken()),
+		Title:     title,
+		TokenCode: s.newToken(),
+		Created:   time.Now().UTC().Format(time.RFC1123Z),
+	}
+}
+
+// robotCredentialsValid returns whether a username and password are the full name and token of a robot account
+func (s *Server) robotCredentialsValid(username string, password string) bool {
+	parts := strings.SplitN(username, "+", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	ns, ok := s.namespaces[parts[0]]
+	if !ok {
+		return false
+	}
+
+	robot, ok := ns.robots[parts[1]]
+
+	return ok && password != "" && robot.Token == password
+}
+
+func (s *Server) newToken() string {
+	s.tokenID++
+	return fmt.Sprintf("token%d", s.tokenID)
+}
+
+// sortedKeys returns the keys of a map with string keys in order
+func sortedKeys(values interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(values).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"error_message": message})
+}
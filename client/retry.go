@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 1 * time.Second
+	DefaultRetryMaxDelay    = 30 * time.Second
+)
+
+// RetryPolicy controls how requests to the Quay API are retried.
+// Requests are retried when they are rate limited (429) and, for idempotent
+// requests, when the connection fails or a 502, 503 or 504 response is returned
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for a request. A value of 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. The delay doubles on each subsequent retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, including delays requested using Retry-After
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none has been configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+	}
+}
+
+// SetRetryPolicy sets the policy used to retry failed requests
+func (c *QuayClient) SetRetryPolicy(retryPolicy RetryPolicy) {
+	c.retryPolicy = retryPolicy
+}
+
+func (p *RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) bool {
+	if attempt >= p.MaxAttempts || req.Context().Err() != nil {
+		return false
+	}
+
+	// Rate limited requests were not processed and can always be retried
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !isIdempotent(req) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// delay returns the time to wait before the next attempt
+func (p *RetryPolicy) delay(resp *http.Response, attempt int) time.Duration {
+	if retryAfter, ok := parseRetryAfter(resp); ok {
+		return p.capDelay(retryAfter)
+	}
+
+	// Cap the backoff before converting it, as float64(math.MaxInt64) overflows a time.Duration
+	backoff := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && backoff > float64(p.MaxDelay) {
+		backoff = float64(p.MaxDelay)
+	}
+	if backoff >= float64(math.MaxInt64) {
+		backoff = float64(math.MaxInt64 / 2)
+	}
+
+	delay := p.capDelay(time.Duration(backoff))
+
+	// Add jitter so that concurrent clients do not retry in lockstep
+	if delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2))) // #nosec G404
+	}
+
+	return delay
+}
+
+func (p *RetryPolicy) capDelay(delay time.Duration) time.Duration {
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return delay
+}
+
+// parseRetryAfter parses the Retry-After header, which contains either a number of seconds or an HTTP date
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	retryAfter := resp.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if retryTime, err := http.ParseTime(retryAfter); err == nil {
+		delay := time.Until(retryTime)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+type nonIdempotentKey struct{}
+
+// nonIdempotent marks a request using an idempotent method that must not be retried once it may have been processed
+func nonIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), nonIdempotentKey{}, true))
+}
+
+func isIdempotent(req *http.Request) bool {
+	if marked, _ := req.Context().Value(nonIdempotentKey{}).(bool); marked {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
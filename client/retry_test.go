@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newRetryTestClient returns a client with short retry delays for a server responding with the given status codes in turn.
+// The last status code is repeated once the others have been used
+func newRetryTestClient(t *testing.T, maxAttempts int, statusCodes ...int) (*QuayClient, *[]string) {
+	t.Helper()
+
+	attempt := 0
+
+	client, paths := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		statusCode := statusCodes[len(statusCodes)-1]
+		if attempt < len(statusCodes) {
+			statusCode = statusCodes[attempt]
+		}
+		attempt++
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(`{}`))
+	})
+
+	client.SetRetryPolicy(RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	})
+
+	return client, paths
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		request      func(client *QuayClient) error
+		wantAttempts int
+		wantError    bool
+	}{
+		{
+			name:         "success",
+			statusCodes:  []int{http.StatusOK},
+			request:      func(client *QuayClient) error { _, _, apiError := client.GetCurrentUser(ctx); return apiError.Error },
+			wantAttempts: 1,
+		},
+		{
+			name:         "idempotent request retried until it succeeds",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			request:      func(client *QuayClient) error { _, _, apiError := client.GetCurrentUser(ctx); return apiError.Error },
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts capped",
+			statusCodes:  []int{http.StatusGatewayTimeout},
+			request:      func(client *QuayClient) error { _, _, apiError := client.GetCurrentUser(ctx); return apiError.Error },
+			wantAttempts: 4,
+			wantError:    true,
+		},
+		{
+			name:         "client errors not retried",
+			statusCodes:  []int{http.StatusBadRequest, http.StatusOK},
+			request:      func(client *QuayClient) error { _, _, apiError := client.GetCurrentUser(ctx); return apiError.Error },
+			wantAttempts: 1,
+			wantError:    true,
+		},
+		{
+			name:        "non-idempotent request not retried on server errors",
+			statusCodes: []int{http.StatusServiceUnavailable, http.StatusOK},
+			request: func(client *QuayClient) error {
+				_, _, apiError := client.RegenerateRobotAccountPassword(ctx, NamespaceTypeOrganization, "example", "build")
+				return apiError.Error
+			},
+			wantAttempts: 1,
+			wantError:    true,
+		},
+		{
+			name:        "non-idempotent request retried when rate limited",
+			statusCodes: []int{http.StatusTooManyRequests, http.StatusOK},
+			request: func(client *QuayClient) error {
+				_, _, apiError := client.RegenerateRobotAccountPassword(ctx, NamespaceTypeOrganization, "example", "build")
+				return apiError.Error
+			},
+			wantAttempts: 2,
+		},
+		{
+			name:        "robot account creation not retried on server errors",
+			statusCodes: []int{http.StatusBadGateway, http.StatusOK},
+			request: func(client *QuayClient) error {
+				_, _, apiError := client.CreateRobotAccount(ctx, NamespaceTypeOrganization, "example", "build", nil)
+				return apiError.Error
+			},
+			wantAttempts: 1,
+			wantError:    true,
+		},
+		{
+			name:        "team creation retried on server errors",
+			statusCodes: []int{http.StatusBadGateway, http.StatusOK},
+			request: func(client *QuayClient) error {
+				_, _, apiError := client.CreateTeam(ctx, "example", &Team{Name: "developers", Role: QuayTeamRoleMember})
+				return apiError.Error
+			},
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, paths := newRetryTestClient(t, 4, tt.statusCodes...)
+
+			err := tt.request(client)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("expected error: %t, got %v", tt.wantError, err)
+			}
+
+			if len(*paths) != tt.wantAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.wantAttempts, len(*paths))
+			}
+		})
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	client, paths := newRetryTestClient(t, 4, http.StatusServiceUnavailable)
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 4, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, _, apiError := client.GetCurrentUser(ctx); apiError.Error == nil {
+		t.Fatal("expected the request to fail once the context is done")
+	}
+
+	if len(*paths) != 1 {
+		t.Fatalf("expected 1 attempt, got %d", len(*paths))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{attempt: 1, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 2, min: time.Second, max: 2 * time.Second},
+		{attempt: 3, min: 2 * time.Second, max: 4 * time.Second},
+		{attempt: 5, min: 5 * time.Second, max: 10 * time.Second},
+		{attempt: 100, min: 5 * time.Second, max: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			// Jitter makes each delay random, so repeat to cover its range
+			for i := 0; i < 100; i++ {
+				if delay := policy.delay(nil, tt.attempt); delay < tt.min || delay > tt.max {
+					t.Fatalf("expected delay between %s and %s, got %s", tt.min, tt.max, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantOK     bool
+		min        time.Duration
+		max        time.Duration
+	}{
+		{
+			name:       "seconds",
+			retryAfter: "7",
+			wantOK:     true,
+			min:        7 * time.Second,
+			max:        7 * time.Second,
+		},
+		{
+			name:       "seconds capped",
+			retryAfter: "120",
+			wantOK:     true,
+			min:        30 * time.Second,
+			max:        30 * time.Second,
+		},
+		{
+			name:       "http date",
+			retryAfter: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat),
+			wantOK:     true,
+			min:        8 * time.Second,
+			max:        10 * time.Second,
+		},
+		{
+			name:       "http date in the past",
+			retryAfter: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat),
+			wantOK:     true,
+		},
+		{
+			name:       "negative",
+			retryAfter: "-1",
+		},
+		{
+			name:       "invalid",
+			retryAfter: "soon",
+		},
+		{
+			name: "missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			retryAfter, ok := parseRetryAfter(resp)
+			if ok != tt.wantOK {
+				t.Fatalf("expected Retry-After '%s' to be parsed: %t", tt.retryAfter, tt.wantOK)
+			}
+
+			if !ok {
+				return
+			}
+
+			if delay := policy.delay(resp, 1); delay < tt.min || delay > tt.max {
+				t.Fatalf("expected delay between %s and %s, got %s (parsed %s)", tt.min, tt.max, delay, retryAfter)
+			}
+		})
+	}
+}
@@ -15,24 +15,79 @@ const (
 	QuayTeamRoleAdmin   QuayTeamRole   = "admin"
 	QuayTeamRoleCreator QuayTeamRole   = "creator"
 	QuayTeamRoleMember  QuayTeamRole   = "member"
+
+	NamespaceTypeUser         = "user"
+	NamespaceTypeOrganization = "organization"
 )
 
 type QuayClient struct {
-	baseURL    *url.URL
-	httpClient *http.Client
-	authToken  string
+	baseURL     *url.URL
+	httpClient  *http.Client
+	authToken   string
+	username    string
+	password    string
+	csrfToken   string
+	retryPolicy RetryPolicy
 }
 
 type PrototypesResponse struct {
 	Prototypes []Prototype `json:"prototypes"`
 }
 
+type User struct {
+	Username string `json:"username"`
+}
+
+type RobotAccountsResponse struct {
+	Robots   []RobotAccount `json:"robots"`
+	NextPage *string        `json:"next_page,omitempty"`
+}
+
+// ListRobotAccountsOptions controls the details returned when listing robot accounts
+type ListRobotAccountsOptions struct {
+	// Permissions includes the teams and repositories of each robot account
+	Permissions bool
+	// Token includes the token of each robot account
+	Token bool
+	// Limit is the maximum number of robot accounts returned per page. The Quay default is used when zero
+	Limit int
+}
+
 type RobotAccount struct {
-	Description  string `json:"description"`
-	Created      string `json:"created"`
-	LastAccessed string `json:"last_accessed"`
-	Token        string `json:"token"`
-	Name         string `json:"name"`
+	Description          string            `json:"description"`
+	Created              string            `json:"created"`
+	LastAccessed         string            `json:"last_accessed"`
+	Token                string            `json:"token"`
+	Name                 string            `json:"name"`
+	UnstructuredMetadata map[string]string `json:"unstructured_metadata,omitempty"`
+	Teams                []RobotTeam       `json:"teams,omitempty"`
+	Repositories         []string          `json:"repositories,omitempty"`
+}
+
+// RobotTeam is a team a robot account belongs to, returned when listing robot accounts with permissions
+type RobotTeam struct {
+	Name string `json:"name"`
+}
+
+type RobotAccountRequest struct {
+	Description          string            `json:"description,omitempty"`
+	UnstructuredMetadata map[string]string `json:"unstructured_metadata,omitempty"`
+}
+
+type ApplicationTokenResponse struct {
+	Token ApplicationToken `json:"token"`
+}
+
+type ApplicationToken struct {
+	UUID       string `json:"uuid"`
+	Title      string `json:"title"`
+	TokenCode  string `json:"token_code,omitempty"`
+	Created    string `json:"created"`
+	Expiration string `json:"expiration,omitempty"`
+}
+
+type ApplicationTokenRequest struct {
+	Title string `json:"title"`
 }
 
 type Prototype struct {
@@ -49,17 +104,42 @@ type PrototypeDelegate struct {
 }
 
 type Team struct {
-	Name string       `json:"name"`
-	Role QuayTeamRole `json:"role"`
+	Name        string       `json:"name"`
+	Role        QuayTeamRole `json:"role"`
+	Description string       `json:"description,omitempty"`
+}
+
+type TeamMembersResponse struct {
+	Members []TeamMember `json:"members"`
+}
+
+type TeamMember struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Robot bool   `json:"is_robot"`
+}
+
+type Organization struct {
+	Name  string          `json:"name"`
+	Teams map[string]Team `json:"teams"`
 }
 
 type RepositoriesResponse struct {
 	Repositories []Repository `json:"repositories"`
-	NextPage     *string      `json:"next_page,omitempty	"`
+	NextPage     *string      `json:"next_page,omitempty"`
 }
 type Repository struct {
-	Name   string `json:"name"`
-	Public bool   `json:"is_public"`
+	Name        string `json:"name"`
+	Public      bool   `json:"is_public"`
+	Description string `json:"description,omitempty"`
+}
+
+type RepositoryCreateRequest struct {
+	Namespace   string `json:"namespace"`
+	Repository  string `json:"repository"`
+	Visibility  string `json:"visibility"`
+	Description string `json:"description"`
+	RepoKind    string `json:"repo_kind,omitempty"`
 }
 
 type PermissionsResponse struct {
@@ -75,11 +155,54 @@ type PermissionUpdateRequest struct {
 	Role string `json:"role"`
 }
 
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+type SignInRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SignInResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// AccessTokenResponse is the token issued in exchange for an OAuth authorization code
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+}
+
+type AuthorizationsResponse struct {
+	Authorizations []Authorization `json:"authorizations"`
+}
+
+// Authorization is an OAuth access token issued to an application on behalf of the user
+type Authorization struct {
+	UUID        string                   `json:"uuid"`
+	Application AuthorizationApplication `json:"application"`
+	Scopes      []AuthorizationScope     `json:"scopes"`
+}
+
+type AuthorizationApplication struct {
+	ClientID string `json:"clientId"`
+	Name     string `json:"name"`
+}
+
+type AuthorizationScope struct {
+	Scope string `json:"scope"`
+}
+
 // StringValue represents an object containing a single string
 type StringValue struct {
 	Value string
 }
 
+// QuayApiError wraps the error returned from a call to the Quay API.
+// Non-2xx responses are reported as a *ResponseError
 type QuayApiError struct {
 	Error error
 }
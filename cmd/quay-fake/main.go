@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+// quay-fake serves an in-memory fake of the Quay API for local development of the plugin
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8080", "Address the fake Quay API listens on")
+	username := flag.String("username", "admin", "User the token authenticates as")
+	token := flag.String("token", "token", "Token accepted by the fake Quay API")
+	organizations := flag.String("organizations", "", "Comma separated list of organizations to create")
+	repositories := flag.String("repositories", "", "Comma separated list of repositories to create formatted as <namespace>/<repository>")
+	flag.Parse()
+
+	server := quaytest.NewUnstartedServer(*username, *token)
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("error listening on %s: %v", *listen, err)
+	}
+	server.Listener = listener
+
+	for _, organization := range splitList(*organizations) {
+		server.AddOrganization(organization)
+	}
+
+	for _, repository := range splitList(*repositories) {
+		parts := strings.SplitN(repository, "/", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid repository '%s', expected <namespace>/<repository>", repository)
+		}
+		server.AddRepository(parts[0], parts[1])
+	}
+
+	server.Start()
+	defer server.Close()
+
+	log.Printf("fake Quay API listening on %s", server.URL)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	<-signals
+}
+
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -13,9 +15,20 @@ import (
 type quayBackend struct {
 	*framework.Backend
 	sync.RWMutex
-	client *client
+	clients map[string]*client
 
-	roleLocks []*locksutil.LockEntry
+	roleLocks      []*locksutil.LockEntry
+	teamLocks      []*locksutil.LockEntry
+	rotateRootLock sync.Mutex
+
+	tidyRunning   uint32
+	lastAutoTidy  time.Time
+	lastIdleCheck time.Time
+
+	poolRefills chan string
+	poolPending map[string]bool
+	poolLock    sync.Mutex
+	poolCancel  context.CancelFunc
 }
 
 var _ logical.Factory = Factory
@@ -27,12 +40,16 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 		return nil, err
 	}
 
+	b.startRobotPoolWorker(conf.StorageView)
+
 	return b, nil
 }
 
 func backend() *quayBackend {
 
-	b := &quayBackend{}
+	b := &quayBackend{
+		clients: make(map[string]*client),
+	}
 	b.Backend = &framework.Backend{
 		Help:        strings.TrimSpace(backendHelp),
 		BackendType: logical.TypeLogical,
@@ -42,54 +59,113 @@ func backend() *quayBackend {
 			},
 			SealWrapStorage: []string{
 				"config",
+				"config/",
+				robotPoolStoragePath + "/",
 			},
 		},
 		Secrets: []*framework.Secret{
 			secretRobot(b),
+			secretLibraryRobot(b),
 		},
 		Paths: framework.PathAppend(
-			[]*framework.Path{
-				pathConfig(b),
-			},
+			pathConfigRotateRoot(b),
+			pathTidy(b),
+			pathIdleCheck(b),
+			pathConfig(b),
 			pathRole(b),
 			pathCredentials(b),
 			pathRotateRole(b),
+			pathStaticRoleStatus(b),
+			pathRoleRobots(b),
+			pathLibraryCheckOut(b),
+			pathLibrary(b),
 		),
-		Invalidate: b.invalidate,
+		InitializeFunc:    b.initialize,
+		Invalidate:        b.invalidate,
+		Clean:             b.stopRobotPoolWorker,
+		PeriodicFunc:      b.periodicFunc,
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: walRollbackMinAge,
 	}
 
 	b.roleLocks = locksutil.CreateLocks()
+	b.teamLocks = locksutil.CreateLocks()
 
 	return b
 
 }
 
-func (b *quayBackend) reset() {
+func (b *quayBackend) reset(connection string) {
 	b.Lock()
 	defer b.Unlock()
-	b.client = nil
+	delete(b.clients, connection)
+}
+
+// initialize records when the mount started tracking the robot accounts it issues, which is when a mount is
+// created or upgraded to a version that tracks them
+func (b *quayBackend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	if !b.canWriteStorage() {
+		return nil
+	}
+
+	_, err := getRobotTrackingStart(ctx, req.Storage)
+
+	return err
 }
 
 func (b *quayBackend) invalidate(ctx context.Context, key string) {
-	if key == "config" {
-		b.reset()
+	if key == configStoragePath {
+		b.reset("")
+	} else if strings.HasPrefix(key, configStoragePath+"/") {
+		b.reset(strings.TrimPrefix(key, configStoragePath+"/"))
 	}
 }
 
-func (b *quayBackend) getClient(ctx context.Context, s logical.Storage) (*client, error) {
+func (b *quayBackend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	// Background jobs change Quay before recording the result, which would leave Quay and storage out of sync
+	if !b.canWriteStorage() {
+		return nil
+	}
+
+	if err := b.rotateStaticRoles(ctx, req.Storage); err != nil {
+		return err
+	}
+
+	if err := b.refillRobotPools(ctx, req.Storage); err != nil {
+		return err
+	}
+
+	if err := b.idleCheck(ctx, req.Storage); err != nil {
+		return err
+	}
+
+	return b.autoTidy(ctx, req.Storage)
+}
+
+// canWriteStorage returns whether this node can write to the storage of the mount. Performance standbys and
+// the secondaries of replicated mounts cannot, so background jobs only run on the node that can
+func (b *quayBackend) canWriteStorage() bool {
+	replicationState := b.System().ReplicationState()
+
+	return (b.System().LocalMount() || !replicationState.HasState(consts.ReplicationPerformanceSecondary)) &&
+		!replicationState.HasState(consts.ReplicationDRSecondary) &&
+		!replicationState.HasState(consts.ReplicationPerformanceStandby)
+}
+
+func (b *quayBackend) getClient(ctx context.Context, s logical.Storage, connection string) (*client, error) {
 	b.RLock()
 	unlockFunc := b.RUnlock
 	defer func() { unlockFunc() }()
 
-	if b.client != nil {
-		return b.client, nil
+	if client, ok := b.clients[connection]; ok {
+		return client, nil
 	}
 
 	b.RUnlock()
 	b.Lock()
 	unlockFunc = b.Unlock
 
-	config, err := getConfig(ctx, s)
+	config, err := getConfig(ctx, s, connection)
 	if err != nil {
 		return nil, err
 	}
@@ -103,9 +179,9 @@ func (b *quayBackend) getClient(ctx context.Context, s logical.Storage) (*client
 		return nil, err
 	}
 
-	b.client = newClient
+	b.clients[connection] = newClient
 
-	return b.client, nil
+	return newClient, nil
 }
 
 const backendHelp = `
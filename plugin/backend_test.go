@@ -0,0 +1,177 @@
+package quay
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+const (
+	testUsername     = "alice"
+	testOrganization = "example"
+)
+
+// getTestBackend returns a backend configured against a fake Quay server
+func getTestBackend(t *testing.T) (*quayBackend, logical.Storage, *quaytest.Server) {
+	t.Helper()
+
+	server := quaytest.NewServer(testUsername, token)
+	t.Cleanup(server.Close)
+
+	server.AddOrganization(testOrganization)
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Cleanup(context.Background()) })
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: config.StorageView}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, b.(*quayBackend), config.StorageView, configStoragePath, map[string]interface{}{
+		"url":   server.URL,
+		"token": token,
+	})
+
+	return b.(*quayBackend), config.StorageView, server
+}
+
+// handleRequest performs a request against the backend and fails the test on an unexpected error
+func handleRequest(t *testing.T, b *quayBackend, s logical.Storage, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: operation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("error performing %s on %s: %v", operation, path, err)
+	}
+
+	return resp
+}
+
+// writeConfig writes a connection and fails the test if it is rejected
+func writeConfig(t *testing.T, b *quayBackend, s logical.Storage, path string, data map[string]interface{}) {
+	t.Helper()
+
+	if resp := handleRequest(t, b, s, logical.CreateOperation, path, data); resp != nil && resp.IsError() {
+		t.Fatalf("error writing %s: %v", path, resp.Error())
+	}
+}
+
+// writeRole writes a role in the test organization, unless data names another namespace, and fails
+// the test if it is rejected. path is either roles/<name> or static-roles/<name>
+func writeRole(t *testing.T, b *quayBackend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	resp := handleRequest(t, b, s, logical.CreateOperation, path, withTestNamespace(data))
+	if resp != nil && resp.IsError() {
+		t.Fatalf("error writing %s: %v", path, resp.Error())
+	}
+
+	return resp
+}
+
+// writeRoleError writes a role in the test organization, unless data names another namespace, and
+// fails the test unless it is rejected with an error containing wantErr
+func writeRoleError(t *testing.T, b *quayBackend, s logical.Storage, path string, data map[string]interface{}, wantErr string) {
+	t.Helper()
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.CreateOperation, path, withTestNamespace(data)), wantErr)
+}
+
+func withTestNamespace(data map[string]interface{}) map[string]interface{} {
+	role := map[string]interface{}{
+		"namespace_name": testOrganization,
+	}
+
+	for key, value := range data {
+		role[key] = value
+	}
+
+	return role
+}
+
+// requireErrorResponse fails the test unless resp is an error containing wantErr
+func requireErrorResponse(t *testing.T, resp *logical.Response, wantErr string) {
+	t.Helper()
+
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error containing '%s', got %v", wantErr, resp)
+	}
+
+	if err := resp.Error().Error(); !strings.Contains(err, wantErr) {
+		t.Fatalf("expected error containing '%s', got '%s'", wantErr, err)
+	}
+}
+
+// readCredentials reads credentials for a dynamic role and returns the response along with the short name of the robot account
+func readCredentials(t *testing.T, b *quayBackend, s logical.Storage, roleName string, namespaceName string) (*logical.Response, string) {
+	t.Helper()
+
+	resp := handleRequest(t, b, s, logical.ReadOperation, "creds/"+roleName, nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error reading credentials: %v", resp)
+	}
+
+	return resp, strings.TrimPrefix(resp.Data["username"].(string), namespaceName+"+")
+}
+
+// readStaticCredentials reads the credentials of a static role
+func readStaticCredentials(t *testing.T, b *quayBackend, s logical.Storage, roleName string) *logical.Response {
+	t.Helper()
+
+	resp := handleRequest(t, b, s, logical.ReadOperation, "static-creds/"+roleName, nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error reading static credentials: %v", resp)
+	}
+
+	return resp
+}
+
+// revokeCredentials revokes the lease of dynamic credentials
+func revokeCredentials(t *testing.T, b *quayBackend, s logical.Storage, secret *logical.Secret) {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("error revoking credentials: resp=%v err=%v", resp, err)
+	}
+}
+
+// requireRobot fails the test unless the existence of a robot account matches exists
+func requireRobot(t *testing.T, server *quaytest.Server, namespaceName string, robotName string, exists bool) {
+	t.Helper()
+
+	if _, ok := server.Robot(namespaceName, robotName); ok != exists {
+		t.Fatalf("expected robot account '%s+%s' to exist: %t", namespaceName, robotName, exists)
+	}
+}
+
+// requireRepositoryPermissions fails the test unless a user holds the expected permission on each repository.
+// An empty permission expects the user to hold no permission on the repository
+func requireRepositoryPermissions(t *testing.T, server *quaytest.Server, namespaceName string, username string, expected map[string]qc.QuayPermission) {
+	t.Helper()
+
+	for repositoryName, permission := range expected {
+		if actual := server.RepositoryPermissions(namespaceName, repositoryName)[username]; actual != permission {
+			t.Fatalf("expected permission '%s' for '%s' on repository '%s', got '%s'", permission, username, repositoryName, actual)
+		}
+	}
+}
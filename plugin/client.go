@@ -3,6 +3,7 @@ package quay
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"net"
 	"net/http"
 
 	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
@@ -14,6 +15,50 @@ type client struct {
 
 func newClient(config *quayConfig) (*client, error) {
 
+	quayClient, err := qc.NewClient(newHTTPClient(config), config.URL, config.Token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	quayClient.SetRetryPolicy(config.retryPolicy())
+
+	return &client{quayClient}, nil
+
+}
+
+// newRobotClient returns a client authenticated as the superuser robot account used to rotate the root token
+func newRobotClient(config *quayConfig) (*client, error) {
+
+	quayClient, err := qc.NewClientWithBasicAuth(newHTTPClient(config), config.URL, config.RobotUsername, config.RobotPassword)
+
+	if err != nil {
+		return nil, err
+	}
+
+	quayClient.SetRetryPolicy(config.retryPolicy())
+
+	return &client{quayClient}, nil
+
+}
+
+// newSessionClient returns a client that signs in to Quay as a user to rotate the root token
+func newSessionClient(config *quayConfig) (*client, error) {
+
+	quayClient, err := qc.NewSessionClient(newHTTPClient(config), config.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	quayClient.SetRetryPolicy(config.retryPolicy())
+
+	return &client{quayClient}, nil
+
+}
+
+func newHTTPClient(config *quayConfig) *http.Client {
+
 	tlsConfig := tls.Config{}
 
 	// Skip SSL Verification
@@ -29,18 +74,16 @@ func newClient(config *quayConfig) (*client, error) {
 		tlsConfig.RootCAs = certPool
 	}
 
-	httpClient := http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tlsConfig,
-		},
+	dialer := &net.Dialer{
+		Timeout: config.dialTimeout(),
 	}
 
-	quayClient, err := qc.NewClient(&httpClient, config.URL, config.Token)
-
-	if err != nil {
-		return nil, err
+	return &http.Client{
+		Timeout: config.requestTimeout(),
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     &tlsConfig,
+			TLSHandshakeTimeout: config.dialTimeout(),
+		},
 	}
-
-	return &client{quayClient}, nil
-
 }
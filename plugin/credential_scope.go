@@ -0,0 +1,119 @@
+package quay
+
+import (
+	"fmt"
+	"strings"
+)
+
+// credentialScope narrows the permissions granted to a dynamic robot account below those of its role
+type credentialScope struct {
+	Repositories []string   `json:"repositories,omitempty"`
+	Permission   Permission `json:"permission,omitempty"`
+}
+
+func (s *credentialScope) isEmpty() bool {
+	return len(s.Repositories) == 0 && s.Permission == ""
+}
+
+// permissionRank orders repository permissions from least to most privileged
+func permissionRank(permission Permission) int {
+	switch permission {
+	case PermissionRead:
+		return 1
+	case PermissionWrite:
+		return 2
+	case PermissionAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// minPermission returns the less privileged of two permissions
+func minPermission(a Permission, b Permission) Permission {
+	if permissionRank(a) <= permissionRank(b) {
+		return a
+	}
+
+	return b
+}
+
+// narrowRole returns a copy of the role that grants only the requested scope. An error is returned
+// if the scope requests a permission the role does not grant.
+//
+// Teams and the ability to create repositories grant access beyond individual repositories, so
+// they are never included in a narrowed role
+func (role *quayRoleEntry) narrowRole(scope *credentialScope) (*quayRoleEntry, error) {
+
+	if scope.Permission != "" && permissionRank(scope.Permission) == 0 {
+		return nil, fmt.Errorf("invalid permission '%s'", scope.Permission)
+	}
+
+	narrowedRole := *role
+	narrowedRole.Teams = nil
+	narrowedRole.CreateRepositories = false
+	narrowedRole.CreateMissingRepositories = false
+
+	narrowedRepositories := map[string]Permission{}
+
+	if len(scope.Repositories) > 0 {
+		// Only the requested repositories are granted
+		narrowedRole.DefaultPermission = nil
+
+		for _, repositoryName := range scope.Repositories {
+			if isRepositoryRegex(repositoryName) || isRepositoryGlob(repositoryName) {
+				return nil, fmt.Errorf("repository '%s' must be a repository name", repositoryName)
+			}
+
+			grantedPermission := role.repositoryPermission(repositoryName)
+			if grantedPermission == nil {
+				return nil, fmt.Errorf("role does not grant access to repository '%s'", repositoryName)
+			}
+
+			permission := *grantedPermission
+			if scope.Permission != "" {
+				if permissionRank(scope.Permission) > permissionRank(permission) {
+					return nil, fmt.Errorf("role grants '%s' rather than '%s' on repository '%s'", permission, scope.Permission, repositoryName)
+				}
+				permission = scope.Permission
+			}
+
+			narrowedRepositories[repositoryName] = permission
+		}
+	} else {
+		// All grants of the role are capped at the requested permission
+		if role.DefaultPermission == nil && (role.Repositories == nil || len(*role.Repositories) == 0) {
+			return nil, fmt.Errorf("role does not grant any repository permissions")
+		}
+
+		if role.DefaultPermission != nil {
+			defaultPermission := minPermission(*role.DefaultPermission, scope.Permission)
+			narrowedRole.DefaultPermission = &defaultPermission
+		}
+
+		if role.Repositories != nil {
+			for key, permission := range *role.Repositories {
+				narrowedRepositories[key] = minPermission(permission, scope.Permission)
+			}
+		}
+	}
+
+	narrowedRole.Repositories = &narrowedRepositories
+
+	return &narrowedRole, nil
+}
+
+// parseCredentialScope builds a credential scope from the repositories and permission requested
+func parseCredentialScope(repositories []string, permission string) *credentialScope {
+	scope := &credentialScope{
+		Permission: Permission(strings.TrimSpace(permission)),
+	}
+
+	for _, repositoryName := range repositories {
+		if repositoryName = strings.TrimSpace(repositoryName); repositoryName != "" {
+			scope.Repositories = append(scope.Repositories, repositoryName)
+		}
+	}
+
+	return scope
+}
@@ -0,0 +1,143 @@
+package quay
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+func TestNarrowRole(t *testing.T) {
+	defaultPermission := PermissionRead
+
+	role := &quayRoleEntry{
+		NamespaceType:      NamespaceTypeOrganization,
+		NamespaceName:      testOrganization,
+		DefaultPermission:  &defaultPermission,
+		CreateRepositories: true,
+		Teams:              &map[string]TeamRole{"developers": TeamRoleMember},
+		Repositories:       &map[string]Permission{"api": PermissionAdmin, "web-*": PermissionWrite},
+	}
+
+	tests := []struct {
+		name                  string
+		scope                 *credentialScope
+		wantRepositories      map[string]Permission
+		wantDefaultPermission *Permission
+		wantErr               string
+	}{
+		{
+			name:             "repositories",
+			scope:            &credentialScope{Repositories: []string{"api", "web-app"}},
+			wantRepositories: map[string]Permission{"api": PermissionAdmin, "web-app": PermissionWrite},
+		},
+		{
+			name:             "repositories and permission",
+			scope:            &credentialScope{Repositories: []string{"api", "web-app"}, Permission: PermissionWrite},
+			wantRepositories: map[string]Permission{"api": PermissionWrite, "web-app": PermissionWrite},
+		},
+		{
+			name:             "repository granted by default permission",
+			scope:            &credentialScope{Repositories: []string{"docs"}},
+			wantRepositories: map[string]Permission{"docs": PermissionRead},
+		},
+		{
+			name:                  "permission caps every grant",
+			scope:                 &credentialScope{Permission: PermissionRead},
+			wantRepositories:      map[string]Permission{"api": PermissionRead, "web-*": PermissionRead},
+			wantDefaultPermission: &defaultPermission,
+		},
+		{
+			name:    "permission exceeding the role",
+			scope:   &credentialScope{Repositories: []string{"web-app"}, Permission: PermissionAdmin},
+			wantErr: "role grants 'write' rather than 'admin' on repository 'web-app'",
+		},
+		{
+			name:    "pattern",
+			scope:   &credentialScope{Repositories: []string{"web-*"}},
+			wantErr: "must be a repository name",
+		},
+		{
+			name:    "invalid permission",
+			scope:   &credentialScope{Permission: "owner"},
+			wantErr: "invalid permission 'owner'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			narrowedRole, err := role.narrowRole(tt.scope)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing '%s', got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*narrowedRole.Repositories, tt.wantRepositories) {
+				t.Fatalf("expected repositories %v, got %v", tt.wantRepositories, *narrowedRole.Repositories)
+			}
+
+			if !reflect.DeepEqual(narrowedRole.DefaultPermission, tt.wantDefaultPermission) {
+				t.Fatalf("expected default permission %v, got %v", tt.wantDefaultPermission, narrowedRole.DefaultPermission)
+			}
+
+			// Grants beyond individual repositories are never included
+			if narrowedRole.Teams != nil || narrowedRole.CreateRepositories {
+				t.Fatal("expected teams and create_repositories to be removed")
+			}
+		})
+	}
+
+	// The role itself is not modified
+	if len(*role.Repositories) != 2 || role.Teams == nil || !role.CreateRepositories {
+		t.Fatal("expected the role not to be modified")
+	}
+
+	noRepositories := &quayRoleEntry{NamespaceType: NamespaceTypeOrganization, NamespaceName: testOrganization}
+	if _, err := noRepositories.narrowRole(&credentialScope{Permission: PermissionRead}); err == nil {
+		t.Fatal("expected an error narrowing a role that grants no repository permissions")
+	}
+}
+
+func TestDynamicCredentialsScope(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+	server.AddRepository(testOrganization, "web")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"teams":        `{"developers": "member"}`,
+		"repositories": `{"api": "write", "web": "write"}`,
+	})
+
+	resp := handleRequest(t, b, s, logical.UpdateOperation, "creds/test", map[string]interface{}{
+		"repositories": "api",
+		"permission":   "read",
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error reading scoped credentials: %v", resp)
+	}
+
+	username := resp.Data["username"].(string)
+
+	requireRepositoryPermissions(t, server, testOrganization, username, map[string]qc.QuayPermission{
+		"api": qc.QuayPermissionRead,
+		"web": "",
+	})
+
+	if members, _ := server.TeamMembers(testOrganization, "developers"); len(members) != 0 {
+		t.Fatalf("expected scoped credentials not to join teams, got %v", members)
+	}
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, "creds/test", map[string]interface{}{
+		"repositories": "docs",
+	}), "role does not grant access to repository 'docs'")
+}
@@ -0,0 +1,126 @@
+package quay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+type CredentialFormat string
+
+const (
+	CredentialFormatRaw              CredentialFormat = "raw"
+	CredentialFormatDockerConfigJSON CredentialFormat = "dockerconfigjson"
+	CredentialFormatPodmanAuth       CredentialFormat = "podman_auth"
+	CredentialFormatK8sSecretYAML    CredentialFormat = "k8s_secret_yaml"
+)
+
+var (
+	invalidSecretNameCharacters = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth"`
+}
+
+func credentialFormatFieldSchema() *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:          framework.TypeString,
+		Description:   "Format of the returned credentials",
+		Default:       string(CredentialFormatRaw),
+		AllowedValues: []interface{}{"raw", "dockerconfigjson", "podman_auth", "k8s_secret_yaml"},
+	}
+}
+
+func parseCredentialFormat(format string) (CredentialFormat, error) {
+	switch CredentialFormat(format) {
+	case CredentialFormatRaw, CredentialFormatDockerConfigJSON, CredentialFormatPodmanAuth, CredentialFormatK8sSecretYAML:
+		return CredentialFormat(format), nil
+	default:
+		return "", fmt.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// formatCredentials adds the representation of the credentials requested by format to data
+func formatCredentials(format CredentialFormat, config *quayConfig, username string, password string, data map[string]interface{}) error {
+	if format == CredentialFormatRaw {
+		return nil
+	}
+
+	registry, err := registryHost(config)
+	if err != nil {
+		return err
+	}
+
+	registryAuth := dockerConfigAuth{
+		Auth: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", username, password))),
+	}
+
+	// Podman only consumes the encoded auth while kubectl also includes the username and password
+	if format != CredentialFormatPodmanAuth {
+		registryAuth.Username = username
+		registryAuth.Password = password
+	}
+
+	authConfigJSON, err := json.Marshal(dockerConfigJSON{
+		Auths: map[string]dockerConfigAuth{
+			registry: registryAuth,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case CredentialFormatDockerConfigJSON:
+		data[string(CredentialFormatDockerConfigJSON)] = string(authConfigJSON)
+	case CredentialFormatPodmanAuth:
+		data[string(CredentialFormatPodmanAuth)] = string(authConfigJSON)
+	case CredentialFormatK8sSecretYAML:
+		data[string(CredentialFormatK8sSecretYAML)] = k8sPullSecretYAML(username, authConfigJSON)
+	}
+
+	return nil
+}
+
+// registryHost returns the host used to reference the Quay registry in an auths document
+func registryHost(config *quayConfig) (string, error) {
+	if config == nil || config.URL == "" {
+		return "", fmt.Errorf("quay connection is not configured")
+	}
+
+	parsedURL, err := neturl.Parse(config.URL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing url '%s': %w", config.URL, err)
+	}
+
+	if parsedURL.Host == "" {
+		return "", fmt.Errorf("unable to determine registry host from url '%s'", config.URL)
+	}
+
+	return parsedURL.Host, nil
+}
+
+func k8sPullSecretYAML(username string, authConfigJSON []byte) string {
+	secretName := strings.Trim(invalidSecretNameCharacters.ReplaceAllString(strings.ToLower(username), "-"), "-.")
+
+	return fmt.Sprintf(`apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+type: kubernetes.io/dockerconfigjson
+data:
+  .dockerconfigjson: %s
+`, secretName, base64.StdEncoding.EncodeToString(authConfigJSON))
+}
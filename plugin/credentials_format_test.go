@@ -0,0 +1,82 @@
+package quay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestFormatCredentials(t *testing.T) {
+	config := &quayConfig{URL: "https://quay.example.com:8443"}
+	auth := base64.StdEncoding.EncodeToString([]byte("example+build:secret"))
+
+	for _, format := range []CredentialFormat{CredentialFormatDockerConfigJSON, CredentialFormatPodmanAuth} {
+		data := map[string]interface{}{}
+		if err := formatCredentials(format, config, "example+build", "secret", data); err != nil {
+			t.Fatal(err)
+		}
+
+		var document dockerConfigJSON
+		if err := json.Unmarshal([]byte(data[string(format)].(string)), &document); err != nil {
+			t.Fatalf("error decoding %s: %v", format, err)
+		}
+
+		registryAuth, ok := document.Auths["quay.example.com:8443"]
+		if !ok || registryAuth.Auth != auth {
+			t.Fatalf("expected auth '%s' for the registry in %s, got %v", auth, format, document.Auths)
+		}
+
+		// Podman only reads the encoded auth
+		if withPassword := registryAuth.Password == "secret"; withPassword != (format == CredentialFormatDockerConfigJSON) {
+			t.Fatalf("unexpected username and password in %s: %v", format, registryAuth)
+		}
+	}
+}
+
+func TestFormatCredentialsK8sSecret(t *testing.T) {
+	data := map[string]interface{}{}
+	if err := formatCredentials(CredentialFormatK8sSecretYAML, &quayConfig{URL: "https://quay.example.com"}, "example+Build_1", "secret", data); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := data[string(CredentialFormatK8sSecretYAML)].(string)
+
+	for _, expected := range []string{"kind: Secret", "name: example-build-1\n", "type: kubernetes.io/dockerconfigjson", ".dockerconfigjson: "} {
+		if !strings.Contains(secret, expected) {
+			t.Fatalf("expected secret to contain '%s', got:\n%s", expected, secret)
+		}
+	}
+}
+
+func TestFormatCredentialsRaw(t *testing.T) {
+	data := map[string]interface{}{}
+
+	// The connection is not needed for raw credentials
+	if err := formatCredentials(CredentialFormatRaw, nil, "example+build", "secret", data); err != nil || len(data) != 0 {
+		t.Fatalf("expected raw credentials to be left unchanged, got %v: %v", data, err)
+	}
+
+	if _, err := parseCredentialFormat("netrc"); err == nil {
+		t.Fatal("expected an unsupported format to be rejected")
+	}
+}
+
+func TestDynamicCredentialsFormat(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	resp := handleRequest(t, b, s, logical.ReadOperation, "creds/test", map[string]interface{}{
+		"format": string(CredentialFormatDockerConfigJSON),
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error reading credentials: %v", resp)
+	}
+
+	if _, ok := resp.Data[string(CredentialFormatDockerConfigJSON)].(string); !ok {
+		t.Fatalf("expected %s in the credentials, got %v", CredentialFormatDockerConfigJSON, resp.Data)
+	}
+}
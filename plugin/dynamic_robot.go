@@ -0,0 +1,264 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	dynamicRobotsStoragePath = "dynamic-robots"
+)
+
+// dynamicRobotEntry records a robot account issued for a dynamic role that has an outstanding lease
+type dynamicRobotEntry struct {
+	Connection    string           `json:"connection,omitempty"`
+	NamespaceType NamespaceType    `json:"namespace_type"`
+	NamespaceName string           `json:"namespace_name"`
+	RobotName     string           `json:"robot_name"`
+	Created       time.Time        `json:"created"`
+	Scope         *credentialScope `json:"scope,omitempty"`
+	Teams         []string         `json:"teams,omitempty"`
+	IdleRevoked   time.Time        `json:"idle_revoked,omitempty"`
+}
+
+func (b *quayBackend) newDynamicRobotEntry(role *quayRoleEntry, robotName string) *dynamicRobotEntry {
+	return &dynamicRobotEntry{
+		Connection:    role.Connection,
+		NamespaceType: role.NamespaceType,
+		NamespaceName: role.NamespaceName,
+		RobotName:     robotName,
+		Created:       time.Now(),
+		Teams:         b.assembleTeamNames(role),
+	}
+}
+
+func dynamicRobotStoragePath(roleName string, robotName string) string {
+	return fmt.Sprintf("%s/%s/%s", dynamicRobotsStoragePath, roleName, robotName)
+}
+
+func (b *quayBackend) saveDynamicRobot(ctx context.Context, s logical.Storage, roleName string, dynamicRobot *dynamicRobotEntry) error {
+	entry, err := logical.StorageEntryJSON(dynamicRobotStoragePath(roleName, dynamicRobot.RobotName), dynamicRobot)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func (b *quayBackend) getDynamicRobot(ctx context.Context, s logical.Storage, roleName string, robotName string) (*dynamicRobotEntry, error) {
+	entry, err := s.Get(ctx, dynamicRobotStoragePath(roleName, robotName))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	dynamicRobot := new(dynamicRobotEntry)
+	if err := entry.DecodeJSON(dynamicRobot); err != nil {
+		return nil, err
+	}
+
+	return dynamicRobot, nil
+}
+
+func (b *quayBackend) deleteDynamicRobot(ctx context.Context, s logical.Storage, roleName string, robotName string) error {
+	return s.Delete(ctx, dynamicRobotStoragePath(roleName, robotName))
+}
+
+// listDynamicRobots returns the names of the robot accounts with outstanding leases for a role
+func (b *quayBackend) listDynamicRobots(ctx context.Context, s logical.Storage, roleName string) ([]string, error) {
+	return s.List(ctx, fmt.Sprintf("%s/%s/", dynamicRobotsStoragePath, roleName))
+}
+
+// revokeDynamicRobot deletes a robot account issued for a dynamic role and stops tracking it.
+// The role may no longer exist. The caller must hold the lock for the role
+func (b *quayBackend) revokeDynamicRobot(ctx context.Context, s logical.Storage, roleName string, dynamicRobot *dynamicRobotEntry) error {
+	client, err := b.getClient(ctx, s, dynamicRobot.Connection)
+	if err != nil {
+		return err
+	}
+
+	if err := b.releaseRobot(ctx, client, dynamicRobot.RobotName, dynamicRobot.NamespaceType, dynamicRobot.NamespaceName, dynamicRobot.Teams, true); err != nil {
+		return err
+	}
+
+	return b.deleteDynamicRobot(ctx, s, roleName, dynamicRobot.RobotName)
+}
+
+// revokeDynamicRobots deletes every robot account with an outstanding lease for a dynamic role.
+// The caller must hold the lock for the role
+func (b *quayBackend) revokeDynamicRobots(ctx context.Context, s logical.Storage, roleName string) error {
+	robotNames, err := b.listDynamicRobots(ctx, s, roleName)
+	if err != nil {
+		return err
+	}
+
+	for _, robotName := range robotNames {
+		dynamicRobot, err := b.getDynamicRobot(ctx, s, roleName, robotName)
+		if err != nil {
+			return err
+		}
+
+		if dynamicRobot == nil {
+			continue
+		}
+
+		if err := b.revokeDynamicRobot(ctx, s, roleName, dynamicRobot); err != nil {
+			return fmt.Errorf("error revoking robot account '%s': %w", robotName, err)
+		}
+
+		b.Logger().Info("revoked robot account of deleted role", "role", roleName, "robot", robotName)
+	}
+
+	return nil
+}
+
+// applyRoleToDynamicRobots brings every robot account with an outstanding lease for a dynamic role in line
+// with the role, removing grants the role no longer makes. Robot accounts that could not be updated are
+// reported as warnings. The caller must hold the lock for the role
+func (b *quayBackend) applyRoleToDynamicRobots(ctx context.Context, s logical.Storage, roleName string, role *quayRoleEntry) ([]string, error) {
+	robotNames, err := b.listDynamicRobots(ctx, s, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := []string{}
+
+	// Teams the role no longer grants may be left without members
+	previousTeams := []string{}
+
+	for _, robotName := range robotNames {
+		dynamicRobot, err := b.getDynamicRobot(ctx, s, roleName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if dynamicRobot == nil {
+			continue
+		}
+
+		// Robot accounts cannot be moved to another namespace
+		if namespaceKey(dynamicRobot.Connection, dynamicRobot.NamespaceType, dynamicRobot.NamespaceName) != namespaceKey(role.Connection, role.NamespaceType, role.NamespaceName) {
+			warnings = append(warnings, fmt.Sprintf("robot account '%s' belongs to namespace '%s' and was not updated", robotName, dynamicRobot.NamespaceName))
+			continue
+		}
+
+		if err := b.applyRoleToDynamicRobot(ctx, s, robotName, role, dynamicRobot.Scope); err != nil {
+			warnings = append(warnings, fmt.Sprintf("error updating robot account '%s': %s", robotName, err))
+			continue
+		}
+
+		// Narrowed robot accounts are never added to teams
+		if dynamicRobot.Scope == nil || dynamicRobot.Scope.isEmpty() {
+			previousTeams = append(previousTeams, dynamicRobot.Teams...)
+			dynamicRobot.Teams = b.assembleTeamNames(role)
+
+			if err := b.saveDynamicRobot(ctx, s, roleName, dynamicRobot); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if role.NamespaceType == NamespaceTypeOrganization {
+		client, err := b.getClient(ctx, s, role.Connection)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.deleteUnusedTeams(ctx, client, role.NamespaceName, previousTeams); err != nil {
+			warnings = append(warnings, fmt.Sprintf("error deleting unused teams: %s", err))
+		}
+	}
+
+	return warnings, nil
+}
+
+func (b *quayBackend) applyRoleToDynamicRobot(ctx context.Context, s logical.Storage, robotName string, role *quayRoleEntry, scope *credentialScope) error {
+	effectiveRole := role
+
+	if scope != nil && !scope.isEmpty() {
+		narrowedRole, err := role.narrowRole(scope)
+		if err != nil {
+			// The role no longer grants the requested scope so every grant is removed
+			narrowedRole = &quayRoleEntry{
+				Connection:    role.Connection,
+				NamespaceType: role.NamespaceType,
+				NamespaceName: role.NamespaceName,
+				Repositories:  &map[string]Permission{},
+			}
+		}
+		effectiveRole = narrowedRole
+	}
+
+	client, err := b.getClient(ctx, s, role.Connection)
+	if err != nil {
+		return err
+	}
+
+	robotAccount, _, apiError := client.GetRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
+	if isRobotNotFound(apiError.Error) {
+		// Robot accounts deleted outside of Vault are not recreated
+		return nil
+	} else if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	drift, err := b.reconcileExistingRobot(ctx, client, &robotAccount, robotName, effectiveRole)
+	if err != nil {
+		return err
+	}
+
+	if !drift.inSync() {
+		b.Logger().Info("applied role changes to robot account", "robot", robotAccount.Name)
+	}
+
+	return nil
+}
+
+// provisionDynamicRobot creates a robot account for a dynamic role. Existing robot accounts are never
+// reused, as they may have been created outside of Vault and would be deleted when the lease is revoked.
+// A WAL entry is written so that the robot account is removed if provisioning does not complete. The
+// caller must delete the returned WAL entry once the robot account has been recorded
+func (b *quayBackend) provisionDynamicRobot(ctx context.Context, s logical.Storage, client *client, robotName string, role *quayRoleEntry, robotAccountRequest *qc.RobotAccountRequest) (*qc.RobotAccount, string, error) {
+	if _, _, apiError := client.GetRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName); apiError.Error == nil {
+		return nil, "", fmt.Errorf("robot account '%s' already exists in namespace '%s'", robotName, role.NamespaceName)
+	} else if !isRobotNotFound(apiError.Error) {
+		return nil, "", apiError.Error
+	}
+
+	walID, err := framework.PutWAL(ctx, s, walRobotKind, &walRobot{
+		Connection:    role.Connection,
+		NamespaceType: role.NamespaceType,
+		NamespaceName: role.NamespaceName,
+		RobotName:     robotName,
+		Teams:         b.assembleTeamNames(role),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	robotAccount, _, apiError := client.CreateRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName, robotAccountRequest)
+	if qc.IsBadRequest(apiError.Error) {
+		// The robot account was created by someone else since it was checked and must not be removed
+		if err := framework.DeleteWAL(ctx, s, walID); err != nil {
+			return nil, "", fmt.Errorf("error deleting WAL entry: %w", err)
+		}
+
+		return nil, "", fmt.Errorf("error creating robot account '%s': %w", robotName, apiError.Error)
+	} else if apiError.Error != nil {
+		return nil, "", apiError.Error
+	}
+
+	if err := b.grantRobot(ctx, client, &robotAccount, robotName, role); err != nil {
+		return nil, "", err
+	}
+
+	return &robotAccount, walID, nil
+}
@@ -0,0 +1,197 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+// quayTimeLayouts are the formats Quay uses for the dates of robot accounts
+var quayTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+}
+
+// parseQuayTime parses a date returned by Quay. The zero time is returned when the date is empty or cannot be parsed
+func parseQuayTime(value string) time.Time {
+	for _, layout := range quayTimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+
+	return time.Time{}
+}
+
+// idleSince returns when a robot account was last used. Robot accounts that have not been used since they
+// were issued or had their password rotated are idle from that point
+func idleSince(robotAccount *qc.RobotAccount, issued time.Time) time.Time {
+	if lastAccessed := parseQuayTime(robotAccount.LastAccessed); lastAccessed.After(issued) {
+		return lastAccessed
+	}
+
+	return issued
+}
+
+// reapIdleRobots revokes the robot accounts of dynamic roles and rotates the passwords of the robot accounts
+// of static roles that have been idle for longer than the max_idle of their role
+func (b *quayBackend) reapIdleRobots(ctx context.Context, s logical.Storage) error {
+	roleNames, err := s.List(ctx, fmt.Sprintf("%s/", rolesStoragePath))
+	if err != nil {
+		return err
+	}
+
+	for _, roleName := range roleNames {
+		if err := b.reapIdleDynamicRobots(ctx, s, roleName); err != nil {
+			b.Logger().Error("error revoking idle robot accounts", "role", roleName, "error", err)
+		}
+	}
+
+	staticRoleNames, err := s.List(ctx, fmt.Sprintf("%s/", staticRolesStoragePath))
+	if err != nil {
+		return err
+	}
+
+	for _, roleName := range staticRoleNames {
+		if err := b.rotateIdleStaticRobot(ctx, s, roleName); err != nil {
+			b.Logger().Error("error rotating idle robot account", "role", roleName, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// reapIdleDynamicRobots deletes the robot accounts with outstanding leases for a dynamic role that have been
+// idle for longer than max_idle. Plugins cannot revoke leases, so the tracking entries of the robot accounts
+// are kept and marked to prevent the leases from being renewed
+func (b *quayBackend) reapIdleDynamicRobots(ctx context.Context, s logical.Storage, roleName string) error {
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := b.getRole(ctx, rolesStoragePath, roleName, s)
+	if err != nil {
+		return err
+	}
+
+	if role == nil || role.MaxIdle == 0 {
+		return nil
+	}
+
+	robotNames, err := b.listDynamicRobots(ctx, s, roleName)
+	if err != nil {
+		return err
+	}
+
+	// Robot accounts are listed once per namespace
+	namespaceRobots := map[string]map[string]qc.RobotAccount{}
+
+	for _, robotName := range robotNames {
+		dynamicRobot, err := b.getDynamicRobot(ctx, s, roleName, robotName)
+		if err != nil {
+			return err
+		}
+
+		if dynamicRobot == nil || !dynamicRobot.IdleRevoked.IsZero() {
+			continue
+		}
+
+		client, err := b.getClient(ctx, s, dynamicRobot.Connection)
+		if err != nil {
+			return err
+		}
+
+		robotNamespaceKey := namespaceKey(dynamicRobot.Connection, dynamicRobot.NamespaceType, dynamicRobot.NamespaceName)
+
+		robots, ok := namespaceRobots[robotNamespaceKey]
+		if !ok {
+			robotAccounts, _, apiError := client.ListRobotAccounts(ctx, dynamicRobot.NamespaceType.String(), dynamicRobot.NamespaceName, nil)
+			if apiError.Error != nil {
+				return apiError.Error
+			}
+
+			robots = make(map[string]qc.RobotAccount, len(robotAccounts))
+			for _, robotAccount := range robotAccounts {
+				robots[robotAccount.Name] = robotAccount
+			}
+			namespaceRobots[robotNamespaceKey] = robots
+		}
+
+		// Robot accounts deleted outside of Vault are left for the lease to clean up
+		robotAccount, ok := robots[robotAccountName(dynamicRobot.NamespaceName, robotName)]
+		if !ok {
+			continue
+		}
+
+		if time.Since(idleSince(&robotAccount, dynamicRobot.Created)) <= role.MaxIdle {
+			continue
+		}
+
+		if err := b.releaseRobot(ctx, client, robotName, dynamicRobot.NamespaceType, dynamicRobot.NamespaceName, dynamicRobot.Teams, true); err != nil {
+			return fmt.Errorf("error revoking robot account '%s': %w", robotAccount.Name, err)
+		}
+
+		dynamicRobot.IdleRevoked = time.Now()
+
+		if err := b.saveDynamicRobot(ctx, s, roleName, dynamicRobot); err != nil {
+			return err
+		}
+
+		b.Logger().Info("revoked idle robot account", "role", roleName, "robot", robotAccount.Name, "last_accessed", robotAccount.LastAccessed, "max_idle", role.MaxIdle.String())
+	}
+
+	return nil
+}
+
+// rotateIdleStaticRobot rotates the password of the robot account of a static role when it has been idle
+// for longer than max_idle
+func (b *quayBackend) rotateIdleStaticRobot(ctx context.Context, s logical.Storage, roleName string) error {
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, s)
+	if err != nil {
+		return err
+	}
+
+	// Robot accounts for static roles are created when the credentials are first read
+	if role == nil || role.MaxIdle == 0 || role.LastRotated.IsZero() {
+		return nil
+	}
+
+	client, err := b.getClient(ctx, s, role.Connection)
+	if err != nil {
+		return err
+	}
+
+	robotAccount, _, apiError := client.GetRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, role.staticRobotName(roleName))
+	if isRobotNotFound(apiError.Error) {
+		return nil
+	} else if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	if time.Since(idleSince(&robotAccount, role.LastRotated)) <= role.MaxIdle {
+		return nil
+	}
+
+	if _, err := b.regenerateRobotPassword(ctx, client, role.staticRobotName(roleName), role); err != nil {
+		return err
+	}
+
+	role.LastRotated = time.Now()
+
+	if err := b.saveRole(ctx, s, role, staticRolesStoragePath, roleName); err != nil {
+		return err
+	}
+
+	b.Logger().Info("rotated password of idle robot account", "role", roleName, "robot", robotAccount.Name, "last_accessed", robotAccount.LastAccessed, "max_idle", role.MaxIdle.String())
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package quay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// issueIdleRobot issues a robot account for a dynamic role and records it as issued two hours ago
+func issueIdleRobot(t *testing.T, b *quayBackend, s logical.Storage, roleName string) (*logical.Response, string) {
+	t.Helper()
+
+	resp, robotName := readCredentials(t, b, s, roleName, testOrganization)
+
+	dynamicRobot, err := b.getDynamicRobot(context.Background(), s, roleName, robotName)
+	if err != nil || dynamicRobot == nil {
+		t.Fatalf("robot account '%s' is not tracked: %v", robotName, err)
+	}
+
+	dynamicRobot.Created = time.Now().Add(-2 * time.Hour)
+	if err := b.saveDynamicRobot(context.Background(), s, roleName, dynamicRobot); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, robotName
+}
+
+func TestReapIdleDynamicRobots(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/idle", map[string]interface{}{
+		"max_idle": "1h",
+	})
+	writeRole(t, b, s, "roles/kept", nil)
+
+	neverUsed, neverUsedName := issueIdleRobot(t, b, s, "idle")
+	_, usedLongAgoName := issueIdleRobot(t, b, s, "idle")
+	_, recentlyUsedName := issueIdleRobot(t, b, s, "idle")
+	_, noMaxIdleName := issueIdleRobot(t, b, s, "kept")
+
+	server.SetRobotLastAccessed(testOrganization, usedLongAgoName, time.Now().Add(-90*time.Minute))
+	server.SetRobotLastAccessed(testOrganization, recentlyUsedName, time.Now().Add(-10*time.Minute))
+
+	if err := b.reapIdleRobots(context.Background(), s); err != nil {
+		t.Fatalf("error reaping idle robot accounts: %v", err)
+	}
+
+	requireRobot(t, server, testOrganization, neverUsedName, false)
+	requireRobot(t, server, testOrganization, usedLongAgoName, false)
+	requireRobot(t, server, testOrganization, recentlyUsedName, true)
+	requireRobot(t, server, testOrganization, noMaxIdleName, true)
+
+	// The lease of a revoked robot account can no longer be renewed but can still be revoked
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Secret:    neverUsed.Secret,
+	})
+	if err != nil {
+		t.Fatalf("error renewing credentials: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the lease of an idle robot account not to be renewable")
+	}
+
+	revokeCredentials(t, b, s, neverUsed.Secret)
+
+	if dynamicRobot, _ := b.getDynamicRobot(context.Background(), s, "idle", neverUsedName); dynamicRobot != nil {
+		t.Fatalf("expected robot account '%s' to no longer be tracked", neverUsedName)
+	}
+}
+
+func TestRotateIdleStaticRobot(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	passwords := map[string]interface{}{}
+	for _, roleName := range []string{"unused", "used"} {
+		writeRole(t, b, s, "static-roles/"+roleName, map[string]interface{}{
+			"max_idle": "1h",
+		})
+
+		passwords[roleName] = readStaticCredentials(t, b, s, roleName).Data["password"]
+
+		// The password was last rotated before max_idle elapsed
+		role, err := b.getRole(context.Background(), staticRolesStoragePath, roleName, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		role.LastRotated = time.Now().Add(-2 * time.Hour)
+		if err := b.saveRole(context.Background(), s, role, staticRolesStoragePath, roleName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server.SetRobotLastAccessed(testOrganization, "used", time.Now().Add(-10*time.Minute))
+
+	if err := b.reapIdleRobots(context.Background(), s); err != nil {
+		t.Fatalf("error reaping idle robot accounts: %v", err)
+	}
+
+	for roleName, wantRotated := range map[string]bool{"unused": true, "used": false} {
+		robot, ok := server.Robot(testOrganization, roleName)
+		if !ok {
+			t.Fatalf("robot account '%s' was deleted", roleName)
+		}
+
+		if rotated := robot.Token != passwords[roleName]; rotated != wantRotated {
+			t.Fatalf("expected the password of '%s' to be rotated: %t", roleName, wantRotated)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	defaultRepositoryVisibility = "private"
+)
+
+// repositoryVisibility returns the visibility of the repositories created for a role
+func (role *quayRoleEntry) repositoryVisibility() string {
+	if role.RepositoryVisibility != "" {
+		return role.RepositoryVisibility
+	}
+
+	return defaultRepositoryVisibility
+}
+
+// missingRepositories returns the repositories named by a role that do not exist in its namespace.
+// Glob and regular expression keys only ever match existing repositories and are ignored
+func (role *quayRoleEntry) missingRepositories(namespaceRepositories []qc.Repository) []string {
+	missing := []string{}
+
+	if role.Repositories == nil {
+		return missing
+	}
+
+	for key := range *role.Repositories {
+		if isRepositoryRegex(key) || isRepositoryGlob(key) {
+			continue
+		}
+
+		if !repositoryExists(key, &namespaceRepositories) {
+			missing = append(missing, key)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// createMissingRepositories creates the repositories named by a role that do not exist in its namespace
+// and returns the repositories of the namespace including those that were created
+func (b *quayBackend) createMissingRepositories(ctx context.Context, client *client, role *quayRoleEntry, namespaceRepositories []qc.Repository) ([]qc.Repository, error) {
+	for _, repositoryName := range role.missingRepositories(namespaceRepositories) {
+		repository, _, apiError := client.CreateRepository(ctx, role.NamespaceName, repositoryName, role.repositoryVisibility(), role.RepositoryDescription)
+		if apiError.Error != nil {
+			return nil, fmt.Errorf("error creating repository '%s': %w", repositoryName, apiError.Error)
+		}
+
+		if repository.Name == "" {
+			repository.Name = repositoryName
+		}
+
+		namespaceRepositories = append(namespaceRepositories, repository)
+
+		b.Logger().Info("created repository", "namespace", role.NamespaceName, "repository", repositoryName)
+	}
+
+	return namespaceRepositories, nil
+}
+
+// validateRepositoriesExist verifies that every repository named by a role exists in its namespace
+func (b *quayBackend) validateRepositoriesExist(ctx context.Context, req *logical.Request, roleEntry *quayRoleEntry) (*logical.Response, error) {
+	if roleEntry.Repositories == nil || len(*roleEntry.Repositories) == 0 {
+		return nil, nil
+	}
+
+	client, err := b.getClient(ctx, req.Storage, roleEntry.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceRepositories, _, apiError := client.GetRepositoriesForNamespace(ctx, roleEntry.NamespaceName)
+	if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	if missing := roleEntry.missingRepositories(namespaceRepositories); len(missing) > 0 {
+		return logical.ErrorResponse("repositories do not exist in namespace '%s': %s", roleEntry.NamespaceName, strings.Join(missing, ", ")), nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package quay
+
+import (
+	"testing"
+
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const testRepositories = `{"api": "read", "new": "write", "web-*": "read"}`
+
+func TestMissingRepositoriesSkipped(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories": testRepositories,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+
+	if _, ok := server.Repository(testOrganization, "new"); ok {
+		t.Fatal("expected repository 'new' not to be created")
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, resp.Data["username"].(string), map[string]qc.QuayPermission{"api": qc.QuayPermissionRead})
+}
+
+func TestMissingRepositoriesCreated(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories":                testRepositories,
+		"create_missing_repositories": true,
+		"repository_visibility":       "public",
+		"repository_description":      "Created by Vault",
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+
+	if _, ok := server.Repository(testOrganization, "web-*"); ok {
+		t.Fatal("repository pattern 'web-*' was created")
+	}
+
+	repository, ok := server.Repository(testOrganization, "new")
+	if !ok {
+		t.Fatal("expected repository 'new' to be created")
+	}
+
+	if !repository.Public || repository.Description != "Created by Vault" {
+		t.Fatalf("unexpected repository 'new': %+v", repository)
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, resp.Data["username"].(string), map[string]qc.QuayPermission{
+		"api": qc.QuayPermissionRead,
+		"new": qc.QuayPermissionWrite,
+	})
+}
+
+func TestStrictRepositories(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+
+	writeRoleError(t, b, s, "roles/test", map[string]interface{}{
+		"repositories":        testRepositories,
+		"strict_repositories": true,
+	}, "repositories do not exist in namespace 'example': new")
+
+	writeRoleError(t, b, s, "roles/test", map[string]interface{}{
+		"repositories":                testRepositories,
+		"strict_repositories":         true,
+		"create_missing_repositories": true,
+	}, "strict_repositories and create_missing_repositories cannot both be set")
+
+	server.AddRepository(testOrganization, "new")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories":        testRepositories,
+		"strict_repositories": true,
+	})
+}
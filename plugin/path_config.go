@@ -3,83 +3,246 @@ package quay
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
 )
 
 const (
-	configStoragePath = "config"
+	configStoragePath     = "config"
+	defaultRequestTimeout = 60 * time.Second
+	defaultDialTimeout    = 10 * time.Second
 )
 
+// defaultTokenScopes are the scopes requested for the token minted when the root token is rotated
+var defaultTokenScopes = []string{"org:admin", "repo:admin", "repo:create", "repo:read", "repo:write", "user:admin", "user:read"}
+
 type quayConfig struct {
-	URL                    string `json:"url"`
-	Token                  string `json:"token"`
-	CaCertificate          string `json:"ca_certificate"`
-	DisableSslVerification bool   `json:"disable_ssl_verification"`
-}
-
-func pathConfig(b *quayBackend) *framework.Path {
-	return &framework.Path{
-		Pattern: "config",
-		Fields: map[string]*framework.FieldSchema{
-			"url": {
-				Type:     framework.TypeString,
-				Required: true,
-				Default:  "https://quay.io",
-				Description: `The URL of the Quay server.
-				Default is "https://quay.io"`,
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name: "Quay URL",
+	URL                    string        `json:"url"`
+	Token                  string        `json:"token"`
+	CaCertificate          string        `json:"ca_certificate"`
+	DisableSslVerification bool          `json:"disable_ssl_verification"`
+	TokenID                string        `json:"token_id,omitempty"`
+	ClientID               string        `json:"client_id,omitempty"`
+	ClientSecret           string        `json:"client_secret,omitempty"`
+	RedirectURI            string        `json:"redirect_uri,omitempty"`
+	TokenScopes            []string      `json:"token_scopes,omitempty"`
+	RobotUsername          string        `json:"robot_username,omitempty"`
+	RobotPassword          string        `json:"robot_password,omitempty"`
+	RetryMaxAttempts       int           `json:"retry_max_attempts,omitempty"`
+	RetryBaseDelay         time.Duration `json:"retry_base_delay,omitempty"`
+	RetryMaxDelay          time.Duration `json:"retry_max_delay,omitempty"`
+	RequestTimeout         time.Duration `json:"request_timeout,omitempty"`
+	DialTimeout            time.Duration `json:"dial_timeout,omitempty"`
+}
+
+func pathConfig(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "config",
+			Fields:  configFieldSchemas(),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathConfigRead,
 				},
-			},
-			"token": {
-				Type:        framework.TypeString,
-				Required:    true,
-				Description: "Token to authenticate against Quay.",
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name:      "Token",
-					Sensitive: true,
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathConfigWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathConfigWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathConfigDelete,
 				},
 			},
-			"ca_certificate": {
-				Type:        framework.TypeString,
-				Description: "Certificate for the Quay server",
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name: "CA Certificate",
+			ExistenceCheck:  b.pathConfigExistenceCheck,
+			HelpSynopsis:    pathConfigHelpSynopsis,
+			HelpDescription: pathConfigHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s", configStoragePath, framework.GenericNameRegex("connection")),
+			Fields:  connectionConfigFieldSchemas(),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathConfigRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathConfigWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathConfigWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathConfigDelete,
 				},
 			},
-			"disable_ssl_verification": {
-				Type:        framework.TypeBool,
-				Default:     false,
-				Description: "Disable SSL verification",
-				DisplayAttrs: &framework.DisplayAttributes{
-					Name: "Disable SSL verification",
+			ExistenceCheck:  b.pathConfigExistenceCheck,
+			HelpSynopsis:    pathConnectionConfigHelpSynopsis,
+			HelpDescription: pathConnectionConfigHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/?$", configStoragePath),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathConfigList,
 				},
 			},
+			HelpSynopsis:    pathConfigListHelpSynopsis,
+			HelpDescription: pathConfigListHelpDescription,
+		},
+	}
+}
+
+func configFieldSchemas() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"url": {
+			Type:     framework.TypeString,
+			Required: true,
+			Default:  "https://quay.io",
+			Description: `The URL of the Quay server.
+			Default is "https://quay.io"`,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Quay URL",
+			},
 		},
-		Operations: map[logical.Operation]framework.OperationHandler{
-			logical.ReadOperation: &framework.PathOperation{
-				Callback: b.pathConfigRead,
+		"token": {
+			Type:        framework.TypeString,
+			Required:    true,
+			Description: "Token to authenticate against Quay.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Token",
+				Sensitive: true,
 			},
-			logical.CreateOperation: &framework.PathOperation{
-				Callback: b.pathConfigWrite,
+		},
+		"ca_certificate": {
+			Type:        framework.TypeString,
+			Description: "Certificate for the Quay server",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "CA Certificate",
 			},
-			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.pathConfigWrite,
+		},
+		"disable_ssl_verification": {
+			Type:        framework.TypeBool,
+			Default:     false,
+			Description: "Disable SSL verification",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Disable SSL verification",
+			},
+		},
+		"token_id": {
+			Type:        framework.TypeString,
+			Description: "UUID of the application token, or of the authorization of the OAuth token, used as the token. Allows the token to be revoked when the root token is rotated.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Token ID",
 			},
-			logical.DeleteOperation: &framework.PathOperation{
-				Callback: b.pathConfigDelete,
+		},
+		"client_id": {
+			Type:        framework.TypeString,
+			Description: "Client ID of the Quay OAuth application used to rotate the root token",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Client ID",
+			},
+		},
+		"client_secret": {
+			Type:        framework.TypeString,
+			Description: "Client secret of the Quay OAuth application used to rotate the root token",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Client Secret",
+				Sensitive: true,
+			},
+		},
+		"redirect_uri": {
+			Type:        framework.TypeString,
+			Description: "Redirect URI of the Quay OAuth application used to rotate the root token",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Redirect URI",
+			},
+		},
+		"token_scopes": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Scopes of the token minted when the root token is rotated",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Token Scopes",
+			},
+		},
+		"robot_username": {
+			Type:        framework.TypeString,
+			Description: "Username of the superuser robot account used to rotate the root token",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Robot Username",
+			},
+		},
+		"robot_password": {
+			Type:        framework.TypeString,
+			Description: "Password of the superuser robot account used to rotate the root token",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:      "Robot Password",
+				Sensitive: true,
+			},
+		},
+		"retry_max_attempts": {
+			Type:        framework.TypeInt,
+			Default:     qc.DefaultRetryMaxAttempts,
+			Description: "Maximum number of attempts made for a request to Quay. Set to 1 to disable retries",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Retry Max Attempts",
+			},
+		},
+		"retry_base_delay": {
+			Type:        framework.TypeDurationSecond,
+			Default:     int(qc.DefaultRetryBaseDelay.Seconds()),
+			Description: "Delay before the first retry of a request to Quay. The delay doubles with each retry",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Retry Base Delay",
+			},
+		},
+		"retry_max_delay": {
+			Type:        framework.TypeDurationSecond,
+			Default:     int(qc.DefaultRetryMaxDelay.Seconds()),
+			Description: "Maximum delay between retries of a request to Quay, including delays requested by Quay using Retry-After",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Retry Max Delay",
+			},
+		},
+		"request_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Default:     int(defaultRequestTimeout.Seconds()),
+			Description: "Timeout for each attempt of a request to Quay",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Request Timeout",
 			},
 		},
-		ExistenceCheck:  b.pathConfigExistenceCheck,
-		HelpSynopsis:    pathConfigHelpSynopsis,
-		HelpDescription: pathConfigHelpDescription,
+		"dial_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Default:     int(defaultDialTimeout.Seconds()),
+			Description: "Timeout for establishing a connection to Quay",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Dial Timeout",
+			},
+		},
+	}
+}
+
+func connectionConfigFieldSchemas() map[string]*framework.FieldSchema {
+	connectionConfigFieldSchemas := configFieldSchemas()
+
+	connectionConfigFieldSchemas["connection"] = &framework.FieldSchema{
+		Type:        framework.TypeLowerCaseString,
+		Description: "Name of the Quay connection",
+		Required:    true,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Connection",
+		},
 	}
+
+	return connectionConfigFieldSchemas
 }
 
 func (b *quayBackend) pathConfigExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
-	out, err := req.Storage.Get(ctx, req.Path)
+	out, err := req.Storage.Get(ctx, configStoragePathForConnection(getConnectionName(data)))
 	if err != nil {
 		return false, fmt.Errorf("existence check failed: %w", err)
 	}
@@ -87,8 +250,17 @@ func (b *quayBackend) pathConfigExistenceCheck(ctx context.Context, req *logical
 	return out != nil, nil
 }
 
+func (b *quayBackend) pathConfigList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, fmt.Sprintf("%s/", configStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
 func (b *quayBackend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := getConfig(ctx, req.Storage)
+	config, err := getConfig(ctx, req.Storage, getConnectionName(data))
 	if err != nil {
 		return nil, err
 	}
@@ -102,12 +274,28 @@ func (b *quayBackend) pathConfigRead(ctx context.Context, req *logical.Request,
 			"url":                      config.URL,
 			"ca_certificate":           config.CaCertificate,
 			"disable_ssl_verification": config.DisableSslVerification,
+			"token_id":                 config.TokenID,
+			"client_id":                config.ClientID,
+			"redirect_uri":             config.RedirectURI,
+			"token_scopes":             config.tokenScopes(),
+			"robot_username":           config.RobotUsername,
+			"retry_max_attempts":       config.retryPolicy().MaxAttempts,
+			"retry_base_delay":         config.retryPolicy().BaseDelay.Seconds(),
+			"retry_max_delay":          config.retryPolicy().MaxDelay.Seconds(),
+			"request_timeout":          config.requestTimeout().Seconds(),
+			"dial_timeout":             config.dialTimeout().Seconds(),
 		},
 	}, nil
 }
 
 func (b *quayBackend) pathConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	config, err := getConfig(ctx, req.Storage)
+	connection := getConnectionName(data)
+
+	if connection == rotateRootPath || connection == autoTidyPath || connection == idleCheckPath {
+		return logical.ErrorResponse("'%s' is a reserved connection name", connection), nil
+	}
+
+	config, err := getConfig(ctx, req.Storage, connection)
 	if err != nil {
 		return nil, err
 	}
@@ -147,32 +335,148 @@ func (b *quayBackend) pathConfigWrite(ctx context.Context, req *logical.Request,
 		config.DisableSslVerification = disableSslVerification.(bool)
 	}
 
-	entry, err := logical.StorageEntryJSON(configStoragePath, config)
-	if err != nil {
-		return nil, err
+	if tokenID, ok := data.GetOk("token_id"); ok {
+		config.TokenID = tokenID.(string)
+	}
+
+	if clientID, ok := data.GetOk("client_id"); ok {
+		config.ClientID = clientID.(string)
+	}
+
+	if clientSecret, ok := data.GetOk("client_secret"); ok {
+		config.ClientSecret = clientSecret.(string)
+	}
+
+	if config.ClientID != "" && config.ClientSecret == "" {
+		return logical.ErrorResponse("client_secret is Required when client_id is specified"), nil
+	}
+
+	if redirectURI, ok := data.GetOk("redirect_uri"); ok {
+		config.RedirectURI = redirectURI.(string)
+	}
+
+	if tokenScopes, ok := data.GetOk("token_scopes"); ok {
+		config.TokenScopes = tokenScopes.([]string)
+	}
+
+	if robotUsername, ok := data.GetOk("robot_username"); ok {
+		config.RobotUsername = robotUsername.(string)
+	}
+
+	if robotPassword, ok := data.GetOk("robot_password"); ok {
+		config.RobotPassword = robotPassword.(string)
+	}
+
+	if config.RobotUsername != "" && config.RobotPassword == "" {
+		return logical.ErrorResponse("robot_password is Required when robot_username is specified"), nil
+	}
+
+	if retryMaxAttempts, ok := data.GetOk("retry_max_attempts"); ok {
+		config.RetryMaxAttempts = retryMaxAttempts.(int)
+	}
+
+	if retryBaseDelay, ok := data.GetOk("retry_base_delay"); ok {
+		config.RetryBaseDelay = time.Duration(retryBaseDelay.(int)) * time.Second
+	}
+
+	if retryMaxDelay, ok := data.GetOk("retry_max_delay"); ok {
+		config.RetryMaxDelay = time.Duration(retryMaxDelay.(int)) * time.Second
+	}
+
+	if config.RetryMaxAttempts < 0 || config.RetryBaseDelay < 0 || config.RetryMaxDelay < 0 {
+		return logical.ErrorResponse("retry settings cannot be negative"), nil
+	}
+
+	if config.RetryMaxDelay != 0 && config.RetryBaseDelay > config.RetryMaxDelay {
+		return logical.ErrorResponse("retry_base_delay cannot be greater than retry_max_delay"), nil
+	}
+
+	if requestTimeout, ok := data.GetOk("request_timeout"); ok {
+		config.RequestTimeout = time.Duration(requestTimeout.(int)) * time.Second
+	}
+
+	if dialTimeout, ok := data.GetOk("dial_timeout"); ok {
+		config.DialTimeout = time.Duration(dialTimeout.(int)) * time.Second
+	}
+
+	if config.RequestTimeout < 0 || config.DialTimeout < 0 {
+		return logical.ErrorResponse("timeouts cannot be negative"), nil
 	}
 
-	if err := req.Storage.Put(ctx, entry); err != nil {
+	if err := saveConfig(ctx, req.Storage, connection, config); err != nil {
 		return nil, err
 	}
 
-	b.reset()
+	b.reset(connection)
 
 	return nil, nil
 }
 
 func (b *quayBackend) pathConfigDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, configStoragePath)
+	connection := getConnectionName(data)
+
+	// Roles and library sets cannot issue or revoke credentials without their connection
+	references, err := b.connectionReferences(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(references) > 0 {
+		return logical.ErrorResponse("connection is still referenced by %s", strings.Join(references, ", ")), nil
+	}
+
+	err = req.Storage.Delete(ctx, configStoragePathForConnection(connection))
 
 	if err == nil {
-		b.reset()
+		b.reset(connection)
 	}
 
 	return nil, err
 }
 
-func getConfig(ctx context.Context, s logical.Storage) (*quayConfig, error) {
-	entry, err := s.Get(ctx, configStoragePath)
+// connectionReferences returns the roles, static roles and library sets that use a connection
+func (b *quayBackend) connectionReferences(ctx context.Context, s logical.Storage, connection string) ([]string, error) {
+	references := []string{}
+
+	for _, storagePath := range []string{rolesStoragePath, staticRolesStoragePath} {
+		roleNames, err := s.List(ctx, fmt.Sprintf("%s/", storagePath))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, roleName := range roleNames {
+			role, err := b.getRole(ctx, storagePath, roleName, s)
+			if err != nil {
+				return nil, err
+			}
+
+			if role != nil && role.Connection == connection {
+				references = append(references, fmt.Sprintf("%s/%s", storagePath, roleName))
+			}
+		}
+	}
+
+	setNames, err := s.List(ctx, fmt.Sprintf("%s/", libraryStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, setName := range setNames {
+		set, err := b.getLibrarySet(ctx, s, setName)
+		if err != nil {
+			return nil, err
+		}
+
+		if set != nil && set.Connection == connection {
+			references = append(references, fmt.Sprintf("%s/%s", libraryStoragePath, setName))
+		}
+	}
+
+	return references, nil
+}
+
+func getConfig(ctx context.Context, s logical.Storage, connection string) (*quayConfig, error) {
+	entry, err := s.Get(ctx, configStoragePathForConnection(connection))
 	if err != nil {
 		return nil, err
 	}
@@ -189,6 +493,77 @@ func getConfig(ctx context.Context, s logical.Storage) (*quayConfig, error) {
 	return config, nil
 }
 
+// retryPolicy returns the policy used to retry requests to Quay. Unset values use the client defaults
+func (c *quayConfig) retryPolicy() qc.RetryPolicy {
+	retryPolicy := qc.DefaultRetryPolicy()
+
+	if c.RetryMaxAttempts != 0 {
+		retryPolicy.MaxAttempts = c.RetryMaxAttempts
+	}
+
+	if c.RetryBaseDelay != 0 {
+		retryPolicy.BaseDelay = c.RetryBaseDelay
+	}
+
+	if c.RetryMaxDelay != 0 {
+		retryPolicy.MaxDelay = c.RetryMaxDelay
+	}
+
+	return retryPolicy
+}
+
+// tokenScopes returns the scopes of the token minted when the root token is rotated
+func (c *quayConfig) tokenScopes() []string {
+	if len(c.TokenScopes) != 0 {
+		return c.TokenScopes
+	}
+
+	return defaultTokenScopes
+}
+
+func (c *quayConfig) requestTimeout() time.Duration {
+	if c.RequestTimeout != 0 {
+		return c.RequestTimeout
+	}
+
+	return defaultRequestTimeout
+}
+
+func (c *quayConfig) dialTimeout() time.Duration {
+	if c.DialTimeout != 0 {
+		return c.DialTimeout
+	}
+
+	return defaultDialTimeout
+}
+
+func saveConfig(ctx context.Context, s logical.Storage, connection string, config *quayConfig) error {
+	entry, err := logical.StorageEntryJSON(configStoragePathForConnection(connection), config)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// getConnectionName returns the name of the connection referenced by the request.
+// An empty name refers to the default connection stored at "config"
+func getConnectionName(data *framework.FieldData) string {
+	if connection, ok := data.GetOk("connection"); ok {
+		return connection.(string)
+	}
+
+	return ""
+}
+
+func configStoragePathForConnection(connection string) string {
+	if connection == "" {
+		return configStoragePath
+	}
+
+	return fmt.Sprintf("%s/%s", configStoragePath, connection)
+}
+
 const pathConfigHelpSynopsis = `Configure the Quay backend.`
 
 const pathConfigHelpDescription = `
@@ -196,3 +571,15 @@ The Quay secret backend requires credentials for managing
 robot accounts associated within an organization on an instance of Quay. This endpoint
 is used to configure those credentials.
 `
+
+const pathConnectionConfigHelpSynopsis = `Configure a named Quay connection.`
+
+const pathConnectionConfigHelpDescription = `
+Named connections allow a single mount to manage robot accounts on multiple
+instances of Quay. Roles reference a named connection using the "connection" option.
+Roles that do not specify a connection use the default connection stored at "config".
+`
+
+const pathConfigListHelpSynopsis = `List the named Quay connections.`
+
+const pathConfigListHelpDescription = `List the names of the configured Quay connections.`
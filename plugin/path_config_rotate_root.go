@@ -0,0 +1,307 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	rotateRootPath = "rotate-root"
+)
+
+func pathConfigRotateRoot(b *quayBackend) []*framework.Path {
+	connectionFields := rotateRootFieldSchemas()
+	connectionFields["connection"] = &framework.FieldSchema{
+		Type:        framework.TypeLowerCaseString,
+		Description: "Name of the Quay connection",
+		Required:    true,
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("%s/%s", configStoragePath, rotateRootPath),
+			Fields:  rotateRootFieldSchemas(),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathConfigRotateRoot,
+			},
+
+			HelpSynopsis:    pathConfigRotateRootHelpSynopsis,
+			HelpDescription: pathConfigRotateRootHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s/%s", configStoragePath, framework.GenericNameRegex("connection"), rotateRootPath),
+			Fields:  connectionFields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathConfigRotateRoot,
+			},
+
+			HelpSynopsis:    pathConfigRotateRootHelpSynopsis,
+			HelpDescription: pathConfigRotateRootHelpDescription,
+		},
+	}
+}
+
+// rotateRootFieldSchemas returns the fields of a rotation. The credentials of the user are only used for the
+// request they are supplied with and are never stored
+func rotateRootFieldSchemas() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"username": {
+			Type:        framework.TypeString,
+			Description: "Username of the Quay user that authorizes the OAuth application. Not stored",
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "Password of the Quay user that authorizes the OAuth application. Not stored",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Sensitive: true,
+			},
+		},
+	}
+}
+
+func (b *quayBackend) pathConfigRotateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	connection := getConnectionName(data)
+	username := data.Get("username").(string)
+	password := data.Get("password").(string)
+
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+
+	config, err := getConfig(ctx, req.Storage, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return logical.ErrorResponse("config not found"), nil
+	}
+
+	switch {
+	case username != "":
+		if password == "" {
+			return logical.ErrorResponse("password is Required when username is specified"), nil
+		}
+
+		if config.ClientID == "" || config.ClientSecret == "" || config.RedirectURI == "" {
+			return logical.ErrorResponse("rotating the root token as a user requires client_id, client_secret and redirect_uri"), nil
+		}
+
+		return b.rotateRootAuthorization(ctx, req, connection, config, username, password)
+	case config.RobotUsername != "":
+		return b.rotateRootApplicationToken(ctx, req, connection, config)
+	default:
+		return logical.ErrorResponse("rotating the root token requires either robot_username and robot_password, or a username and password supplied with the request"), nil
+	}
+}
+
+// rotateRootApplicationToken replaces the root token with an application token created by the superuser robot account
+func (b *quayBackend) rotateRootApplicationToken(ctx context.Context, req *logical.Request, connection string, config *quayConfig) (*logical.Response, error) {
+	robotClient, err := newRobotClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationToken, _, apiError := robotClient.CreateApplicationToken(ctx, fmt.Sprintf("%s-%d", Vault, time.Now().Unix()))
+	if apiError.Error != nil {
+		return nil, fmt.Errorf("error creating application token: %w", apiError.Error)
+	}
+
+	if applicationToken.TokenCode == "" {
+		return nil, fmt.Errorf("no token returned when creating application token")
+	}
+
+	// The previous token is kept until the new token has been shown to work
+	if err := verifyToken(ctx, config, applicationToken.TokenCode, ""); err != nil {
+		if _, apiError := robotClient.RevokeApplicationToken(ctx, applicationToken.UUID); apiError.Error != nil {
+			b.Logger().Warn("error revoking token that failed verification", "token_id", applicationToken.UUID, "error", apiError.Error)
+		}
+
+		return nil, fmt.Errorf("new token failed verification: %w", err)
+	}
+
+	oldTokenID := config.TokenID
+
+	config.Token = applicationToken.TokenCode
+	config.TokenID = applicationToken.UUID
+
+	if err := saveConfig(ctx, req.Storage, connection, config); err != nil {
+		return nil, err
+	}
+
+	b.reset(connection)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"token_id": config.TokenID,
+		},
+	}
+
+	if oldTokenID == "" {
+		resp.AddWarning("The previous token was not revoked as its token_id is unknown")
+		return resp, nil
+	}
+
+	if _, apiError := robotClient.RevokeApplicationToken(ctx, oldTokenID); apiError.Error != nil {
+		if qc.IsNotFound(apiError.Error) {
+			resp.AddWarning(fmt.Sprintf("The previous token was not revoked as no application token exists with token_id '%s'", oldTokenID))
+			return resp, nil
+		}
+
+		return nil, fmt.Errorf("new token stored but error revoking previous token: %w", apiError.Error)
+	}
+
+	return resp, nil
+}
+
+// rotateRootAuthorization replaces the root token with an OAuth token issued to the configured application
+// on behalf of the given user
+func (b *quayBackend) rotateRootAuthorization(ctx context.Context, req *logical.Request, connection string, config *quayConfig, username string, password string) (*logical.Response, error) {
+	sessionClient, err := newSessionClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, apiError := sessionClient.SignIn(ctx, username, password); apiError.Error != nil {
+		return nil, fmt.Errorf("error signing in to Quay: %w", apiError.Error)
+	}
+
+	authorizations, _, apiError := sessionClient.GetAuthorizations(ctx)
+	if apiError.Error != nil {
+		return nil, fmt.Errorf("error listing authorizations: %w", apiError.Error)
+	}
+
+	code, _, apiError := sessionClient.AuthorizeApplication(ctx, config.ClientID, config.RedirectURI, config.tokenScopes())
+	if apiError.Error != nil {
+		return nil, fmt.Errorf("error authorizing application: %w", apiError.Error)
+	}
+
+	accessToken, _, apiError := sessionClient.ExchangeAuthorizationCode(ctx, config.ClientID, config.ClientSecret, config.RedirectURI, code)
+	if apiError.Error != nil {
+		return nil, fmt.Errorf("error exchanging authorization code: %w", apiError.Error)
+	}
+
+	if accessToken.AccessToken == "" {
+		return nil, fmt.Errorf("no token returned when exchanging authorization code")
+	}
+
+	tokenID, err := newAuthorizationUUID(ctx, sessionClient, config.ClientID, authorizations)
+	if err != nil {
+		return nil, err
+	}
+
+	// The previous token is kept until the new token has been shown to work
+	if err := verifyToken(ctx, config, accessToken.AccessToken, username); err != nil {
+		if tokenID != "" {
+			if _, apiError := sessionClient.DeleteAuthorization(ctx, tokenID); apiError.Error != nil {
+				b.Logger().Warn("error revoking token that failed verification", "token_id", tokenID, "error", apiError.Error)
+			}
+		}
+
+		return nil, fmt.Errorf("new token failed verification: %w", err)
+	}
+
+	oldTokenID := config.TokenID
+
+	config.Token = accessToken.AccessToken
+	config.TokenID = tokenID
+
+	if err := saveConfig(ctx, req.Storage, connection, config); err != nil {
+		return nil, err
+	}
+
+	b.reset(connection)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"token_id": config.TokenID,
+		},
+	}
+
+	if tokenID == "" {
+		resp.AddWarning("The token_id of the new token could not be determined, so it will not be revoked by the next rotation")
+	}
+
+	if oldTokenID == "" {
+		resp.AddWarning("The previous token was not revoked as its token_id is unknown")
+		return resp, nil
+	}
+
+	if _, apiError := sessionClient.DeleteAuthorization(ctx, oldTokenID); apiError.Error != nil {
+		if qc.IsNotFound(apiError.Error) {
+			resp.AddWarning(fmt.Sprintf("The previous token was not revoked as no authorization exists with token_id '%s'", oldTokenID))
+			return resp, nil
+		}
+
+		return nil, fmt.Errorf("new token stored but error revoking previous token: %w", apiError.Error)
+	}
+
+	return resp, nil
+}
+
+// newAuthorizationUUID returns the UUID of the single authorization of an application that is not in previous,
+// or an empty string when the authorization of a new token cannot be told apart from the others
+func newAuthorizationUUID(ctx context.Context, sessionClient *client, clientID string, previous []qc.Authorization) (string, error) {
+	authorizations, _, apiError := sessionClient.GetAuthorizations(ctx)
+	if apiError.Error != nil {
+		return "", fmt.Errorf("error listing authorizations: %w", apiError.Error)
+	}
+
+	previousUUIDs := map[string]bool{}
+	for _, authorization := range previous {
+		previousUUIDs[authorization.UUID] = true
+	}
+
+	newUUIDs := []string{}
+	for _, authorization := range authorizations {
+		if authorization.Application.ClientID == clientID && !previousUUIDs[authorization.UUID] {
+			newUUIDs = append(newUUIDs, authorization.UUID)
+		}
+	}
+
+	if len(newUUIDs) != 1 {
+		return "", nil
+	}
+
+	return newUUIDs[0], nil
+}
+
+// verifyToken verifies that a token authenticates, as the given user when username is not empty
+func verifyToken(ctx context.Context, config *quayConfig, token string, username string) error {
+	tokenConfig := *config
+	tokenConfig.Token = token
+
+	client, err := newClient(&tokenConfig)
+	if err != nil {
+		return err
+	}
+
+	user, _, apiError := client.GetCurrentUser(ctx)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	if username != "" && user.Username != username {
+		return fmt.Errorf("token authenticates as '%s' rather than '%s'", user.Username, username)
+	}
+
+	return nil
+}
+
+const pathConfigRotateRootHelpSynopsis = `Rotate the token used to communicate with Quay.`
+
+const pathConfigRotateRootHelpDescription = `
+This path mints a new token and stores it in the configuration once it has
+been verified, after which the previous token is revoked.
+
+When username and password are supplied with the request, the plugin signs in
+to Quay as that user and authorizes the configured OAuth application
+(client_id, client_secret and redirect_uri) with the scopes in token_scopes.
+The credentials of the user are not stored. Otherwise, a new application
+token is created using the superuser robot account configured on the
+connection (robot_username and robot_password).
+`
@@ -0,0 +1,251 @@
+package quay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+const (
+	testClientID     = "vault"
+	testClientSecret = "vault-secret"
+	testRedirectURI  = "https://vault.example.com/callback"
+	testPassword     = "alice-password"
+	testRotateRobot  = "rotator"
+)
+
+// rotateRootCredentials are the credentials of the user supplied when rotating the root token using the OAuth application
+var rotateRootCredentials = map[string]interface{}{
+	"username": testUsername,
+	"password": testPassword,
+}
+
+// configureRotateRoot registers an OAuth application with the fake server and configures the backend
+// to rotate the root token using it. The returned token ID identifies the configured token
+func configureRotateRoot(t *testing.T, b *quayBackend, s logical.Storage, server *quaytest.Server) string {
+	t.Helper()
+
+	server.SetPassword(testPassword)
+	server.AddOAuthApplication(testClientID, testClientSecret, testRedirectURI)
+
+	rootToken, rootTokenID := server.AuthorizeApplication(testClientID)
+
+	writeConfig(t, b, s, configStoragePath, map[string]interface{}{
+		"url":           server.URL,
+		"token":         rootToken,
+		"token_id":      rootTokenID,
+		"client_id":     testClientID,
+		"client_secret": testClientSecret,
+		"redirect_uri":  testRedirectURI,
+	})
+
+	return rootTokenID
+}
+
+// configureRobotRotateRoot creates a superuser robot account on the fake server and configures the backend
+// to rotate the root token using it. The returned token ID identifies the configured application token
+func configureRobotRotateRoot(t *testing.T, b *quayBackend, s logical.Storage, server *quaytest.Server) string {
+	t.Helper()
+
+	robot := server.AddRobot(testUsername, testRotateRobot)
+
+	rootToken, rootTokenID := server.AddApplicationToken("vault")
+
+	writeConfig(t, b, s, configStoragePath, map[string]interface{}{
+		"url":            server.URL,
+		"token":          rootToken,
+		"token_id":       rootTokenID,
+		"robot_username": robot.Name,
+		"robot_password": robot.Token,
+	})
+
+	return rootTokenID
+}
+
+func TestRotateRoot(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	previousTokenID := configureRotateRoot(t, b, s, server)
+
+	for i := 0; i < 2; i++ {
+		resp := handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", rotateRootCredentials)
+		if resp == nil || resp.IsError() || len(resp.Warnings) != 0 {
+			t.Fatalf("unexpected response rotating root token: %v", resp)
+		}
+
+		config, err := getConfig(context.Background(), s, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config.TokenID == previousTokenID || resp.Data["token_id"] != config.TokenID {
+			t.Fatalf("expected a new token_id, got '%s'", config.TokenID)
+		}
+
+		// Only the new token remains authorized
+		authorizations := server.Authorizations()
+		if len(authorizations) != 1 || authorizations[0].UUID != config.TokenID {
+			t.Fatalf("expected only authorization '%s', got %v", config.TokenID, authorizations)
+		}
+
+		previousTokenID = config.TokenID
+	}
+
+	// The backend uses the new token
+	writeRole(t, b, s, "roles/test", nil)
+	readCredentials(t, b, s, "test", testOrganization)
+}
+
+func TestRotateRootVerificationFailure(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	rootTokenID := configureRotateRoot(t, b, s, server)
+
+	previousConfig, err := getConfig(context.Background(), s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.InjectFailure(quaytest.Failure{Method: http.MethodGet, Path: "/api/v1/user/", StatusCode: http.StatusUnauthorized, Count: 1})
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate-root",
+		Storage:   s,
+		Data:      rotateRootCredentials,
+	}); err == nil {
+		t.Fatal("expected rotating the root token to fail verification")
+	}
+
+	config, err := getConfig(context.Background(), s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Token != previousConfig.Token || config.TokenID != rootTokenID {
+		t.Fatal("expected the previous token to be kept")
+	}
+
+	// The token that failed verification is revoked and the previous token is not
+	authorizations := server.Authorizations()
+	if len(authorizations) != 1 || authorizations[0].UUID != rootTokenID {
+		t.Fatalf("expected only authorization '%s', got %v", rootTokenID, authorizations)
+	}
+}
+
+func TestRotateRootUnknownTokenID(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	configureRotateRoot(t, b, s, server)
+
+	writeConfig(t, b, s, configStoragePath, map[string]interface{}{
+		"token_id": "",
+	})
+
+	resp := handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", rotateRootCredentials)
+	if resp == nil || resp.IsError() || len(resp.Warnings) != 1 {
+		t.Fatalf("expected a warning that the previous token was not revoked, got %v", resp)
+	}
+
+	if authorizations := server.Authorizations(); len(authorizations) != 2 {
+		t.Fatalf("expected the previous token to remain authorized, got %v", authorizations)
+	}
+}
+
+func TestRotateRootDoesNotStoreCredentials(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	configureRotateRoot(t, b, s, server)
+
+	handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", rotateRootCredentials)
+
+	entry, err := s.Get(context.Background(), configStoragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry == nil || strings.Contains(string(entry.Value), testPassword) {
+		t.Fatal("expected the password of the user not to be stored")
+	}
+}
+
+func TestRotateRootRobot(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	previousTokenID := configureRobotRotateRoot(t, b, s, server)
+
+	for i := 0; i < 2; i++ {
+		resp := handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", nil)
+		if resp == nil || resp.IsError() || len(resp.Warnings) != 0 {
+			t.Fatalf("unexpected response rotating root token: %v", resp)
+		}
+
+		config, err := getConfig(context.Background(), s, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config.TokenID == previousTokenID || resp.Data["token_id"] != config.TokenID {
+			t.Fatalf("expected a new token_id, got '%s'", config.TokenID)
+		}
+
+		// Only the new application token remains
+		appTokens := server.ApplicationTokens()
+		if len(appTokens) != 1 || appTokens[0].UUID != config.TokenID {
+			t.Fatalf("expected only application token '%s', got %v", config.TokenID, appTokens)
+		}
+
+		previousTokenID = config.TokenID
+	}
+
+	// The backend uses the new token
+	writeRole(t, b, s, "roles/test", nil)
+	readCredentials(t, b, s, "test", testOrganization)
+}
+
+func TestRotateRootRobotVerificationFailure(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	rootTokenID := configureRobotRotateRoot(t, b, s, server)
+
+	server.InjectFailure(quaytest.Failure{Method: http.MethodGet, Path: "/api/v1/user/", StatusCode: http.StatusUnauthorized, Count: 1})
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate-root",
+		Storage:   s,
+	}); err == nil {
+		t.Fatal("expected rotating the root token to fail verification")
+	}
+
+	config, err := getConfig(context.Background(), s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.TokenID != rootTokenID {
+		t.Fatal("expected the previous token to be kept")
+	}
+
+	// The token that failed verification is revoked and the previous token is not
+	appTokens := server.ApplicationTokens()
+	if len(appTokens) != 1 || appTokens[0].UUID != rootTokenID {
+		t.Fatalf("expected only application token '%s', got %v", rootTokenID, appTokens)
+	}
+}
+
+func TestRotateRootRequiresCredentials(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", nil), "requires either robot_username and robot_password, or a username and password")
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", map[string]interface{}{
+		"username": testUsername,
+	}), "password is Required when username is specified")
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, "config/rotate-root", rotateRootCredentials), "requires client_id, client_secret and redirect_uri")
+}
@@ -1,6 +1,154 @@
 package quay
 
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
 const (
 	token = "mysecrettoken"
 	url   = "http://localhost:19090"
 )
+
+func TestConfig(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	for _, path := range []string{configStoragePath, configStoragePath + "/secondary"} {
+		writeConfig(t, b, s, path, map[string]interface{}{
+			"url":   url,
+			"token": token,
+		})
+
+		resp := handleRequest(t, b, s, logical.ReadOperation, path, nil)
+		if resp == nil || resp.IsError() {
+			t.Fatalf("error reading %s: %v", path, resp)
+		}
+
+		if resp.Data["url"] != url {
+			t.Fatalf("expected url '%s', got '%v'", url, resp.Data["url"])
+		}
+
+		if _, ok := resp.Data["token"]; ok {
+			t.Fatal("token must not be returned")
+		}
+
+		if resp := handleRequest(t, b, s, logical.DeleteOperation, path, nil); resp != nil && resp.IsError() {
+			t.Fatalf("error deleting %s: %v", path, resp.Error())
+		}
+
+		if resp := handleRequest(t, b, s, logical.ReadOperation, path, nil); resp != nil {
+			t.Fatalf("expected %s to be deleted, got %v", path, resp.Data)
+		}
+	}
+}
+
+func TestNamedConnection(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	secondary := quaytest.NewServer(testUsername, token)
+	defer secondary.Close()
+	secondary.AddOrganization(testOrganization)
+
+	writeRoleError(t, b, s, "roles/test", map[string]interface{}{
+		"connection": "secondary",
+	}, "connection 'secondary' does not exist")
+
+	writeConfig(t, b, s, configStoragePath+"/secondary", map[string]interface{}{
+		"url":   secondary.URL,
+		"token": token,
+	})
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"connection": "secondary",
+	})
+
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+
+	requireRobot(t, secondary, testOrganization, robotName, true)
+	requireRobot(t, server, testOrganization, robotName, false)
+
+	revokeCredentials(t, b, s, resp.Secret)
+
+	requireRobot(t, secondary, testOrganization, robotName, false)
+}
+
+func TestConfigTimeouts(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	resp := handleRequest(t, b, s, logical.ReadOperation, configStoragePath, nil)
+	if resp.Data["request_timeout"] != defaultRequestTimeout.Seconds() || resp.Data["dial_timeout"] != defaultDialTimeout.Seconds() {
+		t.Fatalf("expected default timeouts, got %v", resp.Data)
+	}
+
+	writeConfig(t, b, s, configStoragePath, map[string]interface{}{
+		"request_timeout": 5,
+		"dial_timeout":    2,
+	})
+
+	config, err := getConfig(context.Background(), s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := newHTTPClient(config)
+	if httpClient.Timeout != 5*time.Second {
+		t.Fatalf("expected a request timeout of 5s, got %s", httpClient.Timeout)
+	}
+
+	if transport := httpClient.Transport.(*http.Transport); transport.TLSHandshakeTimeout != 2*time.Second {
+		t.Fatalf("expected a TLS handshake timeout of 2s, got %s", transport.TLSHandshakeTimeout)
+	}
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, configStoragePath, map[string]interface{}{
+		"request_timeout": -1,
+	}), "cannot provide negative value")
+}
+
+func TestDeleteReferencedConnection(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	secondary := quaytest.NewServer(testUsername, token)
+	defer secondary.Close()
+	secondary.AddOrganization(testOrganization)
+	secondary.AddRobot(testOrganization, "builder")
+
+	writeConfig(t, b, s, configStoragePath+"/secondary", map[string]interface{}{
+		"url":   secondary.URL,
+		"token": token,
+	})
+
+	writeRole(t, b, s, "roles/dynamic", map[string]interface{}{
+		"connection": "secondary",
+	})
+	writeRole(t, b, s, "static-roles/static", map[string]interface{}{
+		"connection": "secondary",
+	})
+	writeConfig(t, b, s, "library/my-set", map[string]interface{}{
+		"connection":     "secondary",
+		"namespace_name": testOrganization,
+		"robot_names":    "builder",
+	})
+
+	// Roles using the default connection do not prevent deleting the named connection
+	writeRole(t, b, s, "roles/default", nil)
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.DeleteOperation, configStoragePath+"/secondary", nil),
+		"connection is still referenced by roles/dynamic, static-roles/static, library/my-set")
+
+	handleRequest(t, b, s, logical.DeleteOperation, "roles/dynamic", nil)
+	handleRequest(t, b, s, logical.DeleteOperation, "static-roles/static", nil)
+	handleRequest(t, b, s, logical.DeleteOperation, "library/my-set", nil)
+
+	if resp := handleRequest(t, b, s, logical.DeleteOperation, configStoragePath+"/secondary", nil); resp != nil && resp.IsError() {
+		t.Fatalf("error deleting connection: %v", resp.Error())
+	}
+
+	if config, err := getConfig(context.Background(), s, "secondary"); err != nil || config != nil {
+		t.Fatalf("expected connection 'secondary' to be deleted, got %v %v", config, err)
+	}
+}
@@ -3,13 +3,13 @@ package quay
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
 )
 
 const secretType = "quay_robot"
@@ -43,9 +43,20 @@ func pathCredentials(b *quayBackend) []*framework.Path {
 					Description: "Name of the role",
 					Required:    true,
 				},
+				"format": credentialFormatFieldSchema(),
+				"repositories": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Repositories to grant the robot account access to. Must be a subset of the repositories granted by the role",
+				},
+				"permission": {
+					Type:          framework.TypeString,
+					Description:   "Permission to grant the robot account. Must not exceed the permission granted by the role",
+					AllowedValues: []interface{}{"admin", "read", "write"},
+				},
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
-				logical.ReadOperation: b.pathCredentialsRead,
+				logical.ReadOperation:   b.pathCredentialsRead,
+				logical.UpdateOperation: b.pathCredentialsRead,
 			},
 
 			HelpSynopsis:    pathCredentialsHelpSyn,
@@ -59,6 +70,7 @@ func pathCredentials(b *quayBackend) []*framework.Path {
 					Description: "Name of the role",
 					Required:    true,
 				},
+				"format": credentialFormatFieldSchema(),
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.ReadOperation: b.pathStaticCredentialsRead,
@@ -76,6 +88,11 @@ func (b *quayBackend) pathCredentialsRead(ctx context.Context, req *logical.Requ
 		return logical.ErrorResponse("name is required"), nil
 	}
 
+	format, err := parseCredentialFormat(data.Get("format").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	role, err := b.getRole(ctx, rolesStoragePath, roleName, req.Storage)
 	if err != nil {
 		return nil, err
@@ -85,22 +102,77 @@ func (b *quayBackend) pathCredentialsRead(ctx context.Context, req *logical.Requ
 		return nil, nil
 	}
 
+	// Narrow the permissions of the robot account to the requested scope
+	scope := parseCredentialScope(data.Get("repositories").([]string), data.Get("permission").(string))
+	if !scope.isEmpty() {
+		role, err = role.narrowRole(scope)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	config, err := getConfig(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
 	lock := locksutil.LockForKey(b.roleLocks, roleName)
 	lock.Lock()
 	defer lock.Unlock()
 
-	client, err := b.getClient(ctx, req.Storage)
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate Robot Account Name
-	randomRoleName := randomSuffix(roleName)
+	var robotAccount *qc.RobotAccount
 
-	robotAccount, err := b.createRobot(client, randomRoleName, role)
+	// Lease a pre-provisioned robot account when the role maintains a pool
+	if role.PoolSize > 0 && scope.isEmpty() {
+		defer b.requestPoolRefill(roleName)
 
-	if err != nil {
-		return nil, err
+		robotAccount, err = b.leasePooledRobot(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Pooled robot accounts were created before they were requested, so their description does not name the requester
+		if robotAccount != nil {
+			b.Logger().Info("leased pooled robot account", "role", roleName, "robot", robotAccount.Name, "entity_id", req.EntityID, "display_name", req.DisplayName)
+		}
+	}
+
+	if robotAccount == nil {
+		// Generate Robot Account Name
+		robotName, err := role.generateRobotName(roleName, req.DisplayName)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		robotAccountRequest, err := role.robotAccountRequest(roleName, req)
+		if err != nil {
+			return nil, err
+		}
+
+		var walID string
+		robotAccount, walID, err = b.provisionDynamicRobot(ctx, req.Storage, client, robotName, role, robotAccountRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		// Track the robot account so that orphaned robot accounts can be identified by tidy
+		dynamicRobot := b.newDynamicRobotEntry(role, robotName)
+		if !scope.isEmpty() {
+			dynamicRobot.Scope = scope
+		}
+
+		if err := b.saveDynamicRobot(ctx, req.Storage, roleName, dynamicRobot); err != nil {
+			return nil, err
+		}
+
+		if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+			return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+		}
 	}
 
 	secretData := map[string]interface{}{
@@ -109,9 +181,26 @@ func (b *quayBackend) pathCredentialsRead(ctx context.Context, req *logical.Requ
 		"username":       robotAccount.Name,
 		"password":       robotAccount.Token,
 	}
+
+	if len(scope.Repositories) > 0 {
+		secretData["repositories"] = scope.Repositories
+	}
+
+	if scope.Permission != "" {
+		secretData["permission"] = scope.Permission
+	}
+
+	if err := formatCredentials(format, config, robotAccount.Name, robotAccount.Token, secretData); err != nil {
+		return nil, err
+	}
+
+	// The namespace is recorded so that the robot account can be revoked once the role has been deleted
 	secretInternalData := map[string]interface{}{
-		"role":     roleName,
-		"username": robotAccount.Name,
+		"role":           roleName,
+		"username":       robotAccount.Name,
+		"connection":     role.Connection,
+		"namespace_type": role.NamespaceType.String(),
+		"namespace_name": role.NamespaceName,
 	}
 
 	resp := b.Secret(secretType).Response(secretData, secretInternalData)
@@ -136,6 +225,16 @@ func (b *quayBackend) pathStaticCredentialsRead(ctx context.Context, req *logica
 		return logical.ErrorResponse("name is required"), nil
 	}
 
+	format, err := parseCredentialFormat(data.Get("format").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// The role is read under the lock as the first read records when tracking rotations started
 	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, req.Storage)
 	if err != nil {
 		return nil, err
@@ -145,28 +244,59 @@ func (b *quayBackend) pathStaticCredentialsRead(ctx context.Context, req *logica
 		return nil, nil
 	}
 
-	lock := locksutil.LockForKey(b.roleLocks, roleName)
-	lock.Lock()
-	defer lock.Unlock()
+	config, err := getConfig(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
 
-	client, err := b.getClient(ctx, req.Storage)
+	robotAccountRequest, err := role.robotAccountRequest(roleName, req)
 	if err != nil {
 		return nil, err
 	}
 
-	robotAccount, err := b.createRobot(client, roleName, role)
+	robotAccount, err := b.createRobot(ctx, client, role.staticRobotName(roleName), role, robotAccountRequest)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// Start tracking rotations once the robot account exists
+	if role.LastRotated.IsZero() {
+		role.LastRotated = time.Now()
+		if err := b.saveRole(ctx, req.Storage, role, staticRolesStoragePath, roleName); err != nil {
+			return nil, err
+		}
+	}
+
+	respData := map[string]interface{}{
+		"namespace_type":  role.NamespaceType,
+		"namespaces_name": role.NamespaceName,
+		"username":        robotAccount.Name,
+		"password":        robotAccount.Token,
+		"last_rotated":    role.LastRotated,
+	}
+
+	if role.RotationPeriod != 0 {
+		ttl := time.Until(role.LastRotated.Add(role.RotationPeriod))
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		respData["rotation_period"] = role.RotationPeriod.Seconds()
+		respData["ttl"] = int64(ttl.Seconds())
+	}
+
+	if err := formatCredentials(format, config, robotAccount.Name, robotAccount.Token, respData); err != nil {
+		return nil, err
+	}
+
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"namespace_type":  role.NamespaceType,
-			"namespaces_name": role.NamespaceName,
-			"username":        robotAccount.Name,
-			"password":        robotAccount.Token,
-		},
+		Data: respData,
 	}, nil
 
 }
@@ -186,6 +316,24 @@ func (b *quayBackend) robotAccountRenew(ctx context.Context, req *logical.Reques
 		return nil, nil
 	}
 
+	// Track robot accounts issued before tracking was introduced
+	if usernameRaw, ok := req.Secret.InternalData["username"]; ok {
+		robotName := robotShortName(usernameRaw.(string))
+
+		dynamicRobot, err := b.getDynamicRobot(ctx, req.Storage, roleRaw.(string), robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if dynamicRobot == nil {
+			if err := b.saveDynamicRobot(ctx, req.Storage, roleRaw.(string), b.newDynamicRobotEntry(role, robotName)); err != nil {
+				return nil, err
+			}
+		} else if !dynamicRobot.IdleRevoked.IsZero() {
+			return logical.ErrorResponse("robot account '%s' was revoked after being idle for longer than max_idle", usernameRaw.(string)), nil
+		}
+	}
+
 	resp := &logical.Response{Secret: req.Secret}
 
 	if role.TTL != 0 {
@@ -210,48 +358,69 @@ func (b *quayBackend) robotAccountRevoke(ctx context.Context, req *logical.Reque
 		return logical.ErrorResponse("internal data 'role' not found"), nil
 	}
 
-	role, err := b.getRole(ctx, rolesStoragePath, roleRaw.(string), req.Storage)
+	lock := locksutil.LockForKey(b.roleLocks, roleRaw.(string))
+	lock.Lock()
+	defer lock.Unlock()
+
+	robotName := robotShortName(usernameRaw.(string))
+
+	namespace, err := b.revocationNamespace(ctx, req, roleRaw.(string), robotName)
 	if err != nil {
 		return nil, err
 	}
 
-	if role == nil {
+	if namespace == nil {
+		b.Logger().Warn("unable to determine the namespace of the robot account to revoke", "role", roleRaw.(string), "robot", usernameRaw.(string))
 		return nil, nil
 	}
 
-	lock := locksutil.LockForKey(b.roleLocks, roleRaw.(string))
-	lock.Lock()
-	defer lock.Unlock()
+	if err := b.revokeDynamicRobot(ctx, req.Storage, roleRaw.(string), namespace); err != nil {
+		return nil, err
+	}
 
-	username := usernameRaw.(string)
+	return nil, nil
+}
 
-	client, err := b.getClient(ctx, req.Storage)
-	if err != nil {
-		return nil, err
+// revocationNamespace determines the namespace of a robot account being revoked. The robot account tracking
+// entry is preferred as it records the teams of the robot account, followed by the namespace recorded in the
+// lease and finally the role for leases issued by earlier versions of the plugin. nil is returned when the
+// namespace cannot be determined
+func (b *quayBackend) revocationNamespace(ctx context.Context, req *logical.Request, roleName string, robotName string) (*dynamicRobotEntry, error) {
+	dynamicRobot, err := b.getDynamicRobot(ctx, req.Storage, roleName, robotName)
+	if err != nil || dynamicRobot != nil {
+		return dynamicRobot, err
 	}
 
-	// Split out parts of robot account
-	usernameSplit := strings.Split(username, "+")
+	if namespaceName, ok := req.Secret.InternalData["namespace_name"]; ok {
+		namespace := &dynamicRobotEntry{
+			NamespaceType: NamespaceType(req.Secret.InternalData["namespace_type"].(string)),
+			NamespaceName: namespaceName.(string),
+			RobotName:     robotName,
+		}
 
-	return nil, b.deleteRobot(client, usernameSplit[len(usernameSplit)-1], role)
-}
+		if connection, ok := req.Secret.InternalData["connection"]; ok {
+			namespace.Connection = connection.(string)
+		}
+
+		return namespace, nil
+	}
 
-func randomSuffix(input string) string {
-	rand.Seed(time.Now().Unix())
-	charSet := []rune("abcdefghijklmnopqrstuvqxyz")
-	var output strings.Builder
-	length := 5
-	for i := 0; i < length; i++ {
-		random := rand.Intn(len(charSet))
-		randomChar := charSet[random]
-		output.WriteRune(randomChar)
+	role, err := b.getRole(ctx, rolesStoragePath, roleName, req.Storage)
+	if err != nil || role == nil {
+		return nil, err
 	}
 
-	return fmt.Sprintf("%s-%s", input, output.String())
+	return b.newDynamicRobotEntry(role, robotName), nil
+}
+
+// robotShortName returns the name of a robot account without the namespace prefix
+func robotShortName(username string) string {
+	usernameSplit := strings.Split(username, "+")
 
+	return usernameSplit[len(usernameSplit)-1]
 }
 
 const pathCredentialsHelpSyn = "Generate the credential of the Quay robot account based on the associated Vault role."
-const pathCredentialsHelpDesc = "Generate the credential of the Quay robot account based on the associated Vault role."
+const pathCredentialsHelpDesc = "Generate the credential of the Quay robot account based on the associated Vault role. The repositories and permission parameters narrow the robot account to a subset of the permissions granted by the role."
 const pathStaticCredentialsHelpSyn = "Return the credential of the static Quay robot account based on the associated Vault role."
 const pathStaticCredentialsHelpDesc = "Return the credential of the static Quay robot account based on the associated Vault role."
@@ -0,0 +1,201 @@
+package quay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+func TestDynamicCredentials(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"default_permission": "read",
+		"repositories":       `{"api": "write"}`,
+	})
+
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+	username := resp.Data["username"].(string)
+
+	robot, ok := server.Robot(testOrganization, robotName)
+	if !ok {
+		t.Fatalf("robot account '%s' was not created", username)
+	}
+
+	if resp.Data["password"] != robot.Token {
+		t.Fatalf("expected password '%s', got '%s'", robot.Token, resp.Data["password"])
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, username, map[string]qc.QuayPermission{"api": qc.QuayPermissionWrite})
+
+	prototypes := server.Prototypes(testOrganization)
+	if len(prototypes) != 1 || prototypes[0].Delegate.Name != username || prototypes[0].Role != "read" {
+		t.Fatalf("expected read prototype for '%s', got %v", username, prototypes)
+	}
+
+	revokeCredentials(t, b, s, resp.Secret)
+
+	requireRobot(t, server, testOrganization, robotName, false)
+
+	if prototypes := server.Prototypes(testOrganization); len(prototypes) != 0 {
+		t.Fatalf("expected no prototypes, got %v", prototypes)
+	}
+}
+
+func TestDynamicCredentialsRepositoryPagination(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	expected := map[string]qc.QuayPermission{}
+	for _, repositoryName := range []string{"api", "cli", "web"} {
+		server.AddRepository(testOrganization, repositoryName)
+		expected[repositoryName] = qc.QuayPermissionRead
+	}
+
+	server.SetPageSize(1)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories": `{"*": "read"}`,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+
+	requireRepositoryPermissions(t, server, testOrganization, resp.Data["username"].(string), expected)
+}
+
+func TestDynamicCredentialsUserNamespace(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testUsername, "api")
+	server.AddRepository(testUsername, "web")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"namespace_type": string(NamespaceTypeUser),
+		"namespace_name": testUsername,
+		"repositories":   `{"api": "write", "web": "read"}`,
+	})
+
+	resp, robotName := readCredentials(t, b, s, "test", testUsername)
+
+	username := resp.Data["username"].(string)
+	if !strings.HasPrefix(username, testUsername+"+test-") {
+		t.Fatalf("unexpected username '%s'", username)
+	}
+
+	requireRobot(t, server, testUsername, robotName, true)
+	requireRepositoryPermissions(t, server, testUsername, username, map[string]qc.QuayPermission{"api": qc.QuayPermissionWrite, "web": qc.QuayPermissionRead})
+
+	for _, request := range server.Requests() {
+		if strings.Contains(request, "/robots/") && !strings.Contains(request, "/api/v1/user/robots/") {
+			t.Fatalf("unexpected robot account endpoint '%s'", request)
+		}
+	}
+
+	revokeCredentials(t, b, s, resp.Secret)
+
+	requireRobot(t, server, testUsername, robotName, false)
+}
+
+func TestDynamicCredentialsUserNamespaceDefaultPermission(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testUsername, "api")
+	server.AddRepository(testUsername, "web")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"namespace_type":     string(NamespaceTypeUser),
+		"namespace_name":     testUsername,
+		"default_permission": "read",
+		"repositories":       `{"api": "write"}`,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testUsername)
+
+	// The default permission is applied to the existing repositories of the user
+	requireRepositoryPermissions(t, server, testUsername, resp.Data["username"].(string), map[string]qc.QuayPermission{"api": qc.QuayPermissionWrite, "web": qc.QuayPermissionRead})
+
+	// Default permissions for new repositories are an organization feature
+	for _, request := range server.Requests() {
+		if strings.Contains(request, "/prototypes") {
+			t.Fatalf("unexpected prototype endpoint '%s'", request)
+		}
+	}
+}
+
+func TestRevokeDynamicCredentialsErrors(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	// Robot accounts deleted outside of Vault are treated as revoked
+	deleted, deletedRobotName := readCredentials(t, b, s, "test", testOrganization)
+	server.InjectFailure(quaytest.Failure{Method: http.MethodDelete, Path: "/api/v1/organization/example/robots/" + deletedRobotName, StatusCode: http.StatusNotFound, Count: 1})
+
+	revokeCredentials(t, b, s, deleted.Secret)
+
+	// Other errors fail the revocation so that it is retried
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+	server.InjectFailure(quaytest.Failure{Method: http.MethodDelete, Path: "/api/v1/organization/example/robots/" + robotName, StatusCode: http.StatusInternalServerError, Count: 1})
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    resp.Secret,
+	}); err == nil || qc.StatusCode(err) != http.StatusInternalServerError {
+		t.Fatalf("expected revocation to fail with a 500 response error, got %v", err)
+	}
+
+	requireRobot(t, server, testOrganization, robotName, true)
+}
+
+func TestRevokeDynamicCredentialsAfterRoleDeleted(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+
+	// Leases issued by earlier versions of the plugin do not record the namespace
+	legacyResp, legacyRobotName := readCredentials(t, b, s, "test", testOrganization)
+	delete(legacyResp.Secret.InternalData, "connection")
+	delete(legacyResp.Secret.InternalData, "namespace_type")
+	delete(legacyResp.Secret.InternalData, "namespace_name")
+
+	handleRequest(t, b, s, logical.DeleteOperation, "roles/test", nil)
+
+	// Robot accounts with outstanding leases remain until the leases are revoked
+	requireRobot(t, server, testOrganization, robotName, true)
+	requireRobot(t, server, testOrganization, legacyRobotName, true)
+
+	revokeCredentials(t, b, s, resp.Secret)
+	requireRobot(t, server, testOrganization, robotName, false)
+
+	// The namespace of the legacy lease is found in the tracking entry of the robot account
+	revokeCredentials(t, b, s, legacyResp.Secret)
+	requireRobot(t, server, testOrganization, legacyRobotName, false)
+}
+
+func TestRevokeOnDelete(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"revoke_on_delete": true,
+	})
+
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+	_, otherRobotName := readCredentials(t, b, s, "test", testOrganization)
+
+	handleRequest(t, b, s, logical.DeleteOperation, "roles/test", nil)
+
+	requireRobot(t, server, testOrganization, robotName, false)
+	requireRobot(t, server, testOrganization, otherRobotName, false)
+
+	// Revoking the remaining lease once the robot account is gone succeeds
+	revokeCredentials(t, b, s, resp.Secret)
+}
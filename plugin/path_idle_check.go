@@ -0,0 +1,132 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	idleCheckPath            = "idle-check"
+	idleCheckStoragePath     = "idle-check"
+	defaultIdleCheckInterval = time.Hour
+)
+
+type idleCheckConfig struct {
+	Interval time.Duration `json:"interval"`
+}
+
+func pathIdleCheck(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("%s/%s", configStoragePath, idleCheckPath),
+			Fields: map[string]*framework.FieldSchema{
+				"interval": {
+					Type:        framework.TypeDurationSecond,
+					Default:     int(defaultIdleCheckInterval.Seconds()),
+					Description: "Interval between checks for robot accounts left idle past the max_idle of their role",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIdleCheckConfigRead,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathIdleCheckConfigWrite,
+				},
+			},
+
+			HelpSynopsis:    pathIdleCheckConfigHelpSynopsis,
+			HelpDescription: pathIdleCheckConfigHelpDescription,
+		},
+	}
+}
+
+func (b *quayBackend) pathIdleCheckConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getIdleCheckConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"interval": config.Interval.Seconds(),
+		},
+	}, nil
+}
+
+func (b *quayBackend) pathIdleCheckConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getIdleCheckConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if interval, ok := data.GetOk("interval"); ok {
+		config.Interval = time.Duration(interval.(int)) * time.Second
+	}
+
+	if config.Interval <= 0 {
+		return logical.ErrorResponse("interval must be greater than 0"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(idleCheckStoragePath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, req.Storage.Put(ctx, entry)
+}
+
+func getIdleCheckConfig(ctx context.Context, s logical.Storage) (*idleCheckConfig, error) {
+	config := &idleCheckConfig{
+		Interval: defaultIdleCheckInterval,
+	}
+
+	entry, err := s.Get(ctx, idleCheckStoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("error reading idle check configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// idleCheck revokes or rotates the robot accounts left idle past the max_idle of their role once the interval
+// has elapsed since the previous check. Each check lists the robot accounts of every namespace with idle limits
+func (b *quayBackend) idleCheck(ctx context.Context, s logical.Storage) error {
+	config, err := getIdleCheckConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	b.Lock()
+	due := time.Now().After(b.lastIdleCheck.Add(config.Interval))
+	if due {
+		b.lastIdleCheck = time.Now()
+	}
+	b.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	return b.reapIdleRobots(ctx, s)
+}
+
+const pathIdleCheckConfigHelpSynopsis = `Configure how often robot accounts are checked for being idle.`
+
+const pathIdleCheckConfigHelpDescription = `
+Robot accounts of roles that set max_idle are checked once the configured
+interval has elapsed since the previous check. Robot accounts may remain in
+use for up to the interval after they exceed max_idle.
+`
@@ -0,0 +1,69 @@
+package quay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestIdleCheckConfig(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	resp := handleRequest(t, b, s, logical.ReadOperation, "config/idle-check", nil)
+	if resp == nil || resp.Data["interval"] != defaultIdleCheckInterval.Seconds() {
+		t.Fatalf("expected the default interval, got %v", resp)
+	}
+
+	if resp := handleRequest(t, b, s, logical.UpdateOperation, "config/idle-check", map[string]interface{}{
+		"interval": "15m",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("error writing config/idle-check: %v", resp.Error())
+	}
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "config/idle-check", nil)
+	if resp == nil || resp.Data["interval"] != (15*time.Minute).Seconds() {
+		t.Fatalf("expected an interval of 15m, got %v", resp)
+	}
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, "config/idle-check", map[string]interface{}{
+		"interval": 0,
+	}), "interval must be greater than 0")
+}
+
+func TestIdleCheckInterval(t *testing.T) {
+	b, s, server := getTestBackend(t)
+	ctx := context.Background()
+
+	writeRole(t, b, s, "roles/idle", map[string]interface{}{
+		"max_idle": "1h",
+	})
+
+	_, firstRobotName := issueIdleRobot(t, b, s, "idle")
+
+	if err := b.idleCheck(ctx, s); err != nil {
+		t.Fatalf("error checking for idle robot accounts: %v", err)
+	}
+
+	requireRobot(t, server, testOrganization, firstRobotName, false)
+
+	// Robot accounts are not checked again until the interval has elapsed
+	_, secondRobotName := issueIdleRobot(t, b, s, "idle")
+
+	if err := b.idleCheck(ctx, s); err != nil {
+		t.Fatalf("error checking for idle robot accounts: %v", err)
+	}
+
+	requireRobot(t, server, testOrganization, secondRobotName, true)
+
+	b.Lock()
+	b.lastIdleCheck = time.Now().Add(-defaultIdleCheckInterval)
+	b.Unlock()
+
+	if err := b.idleCheck(ctx, s); err != nil {
+		t.Fatalf("error checking for idle robot accounts: %v", err)
+	}
+
+	requireRobot(t, server, testOrganization, secondRobotName, false)
+}
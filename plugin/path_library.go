@@ -0,0 +1,490 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	libraryStoragePath          = "library"
+	libraryCheckOutsStoragePath = "library-checkouts"
+)
+
+// librarySetEntry is a set of existing robot accounts that can be checked out exclusively
+type librarySetEntry struct {
+	Connection                string        `json:"connection,omitempty"`
+	NamespaceType             NamespaceType `json:"namespace_type"`
+	NamespaceName             string        `json:"namespace_name"`
+	RobotNames                []string      `json:"robot_names"`
+	TTL                       time.Duration `json:"ttl,omitempty"`
+	MaxTTL                    time.Duration `json:"max_ttl,omitempty"`
+	DisableCheckInEnforcement bool          `json:"disable_check_in_enforcement,omitempty"`
+}
+
+// libraryCheckOutEntry records a robot account that is checked out from a set
+type libraryCheckOutEntry struct {
+	CheckOutID                  string    `json:"check_out_id"`
+	BorrowerEntityID            string    `json:"borrower_entity_id,omitempty"`
+	BorrowerClientTokenAccessor string    `json:"borrower_client_token_accessor,omitempty"`
+	CheckedOut                  time.Time `json:"checked_out"`
+}
+
+func pathLibrary(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("%s/%s", libraryStoragePath, framework.GenericNameRegex("name")),
+			Fields:  librarySetFieldSchemas(),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathLibrarySetRead,
+				},
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathLibrarySetWrite,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathLibrarySetWrite,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathLibrarySetDelete,
+				},
+			},
+			ExistenceCheck:  b.pathLibrarySetExistenceCheck,
+			HelpSynopsis:    pathLibrarySetHelpSynopsis,
+			HelpDescription: pathLibrarySetHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/?$", libraryStoragePath),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathLibrarySetList,
+				},
+			},
+			HelpSynopsis:    pathLibrarySetListHelpSynopsis,
+			HelpDescription: pathLibrarySetListHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s/status", libraryStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the set",
+					Required:    true,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathLibrarySetStatus,
+			},
+			HelpSynopsis:    pathLibrarySetStatusHelpSynopsis,
+			HelpDescription: pathLibrarySetStatusHelpDescription,
+		},
+	}
+}
+
+func (b *quayBackend) pathLibrarySetExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	set, err := b.getLibrarySet(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return set != nil, nil
+}
+
+func (b *quayBackend) pathLibrarySetList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, fmt.Sprintf("%s/", libraryStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *quayBackend) pathLibrarySetRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	set, err := b.getLibrarySet(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"connection":                   set.Connection,
+			"namespace_name":               set.NamespaceName,
+			"namespace_type":               set.NamespaceType,
+			"robot_names":                  set.RobotNames,
+			"ttl":                          set.TTL.Seconds(),
+			"max_ttl":                      set.MaxTTL.Seconds(),
+			"disable_check_in_enforcement": set.DisableCheckInEnforcement,
+		},
+	}, nil
+}
+
+func (b *quayBackend) pathLibrarySetWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	setName := data.Get("name").(string)
+	if setName == "" {
+		return logical.ErrorResponse("name is required"), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, librarySetLockKey(setName))
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := b.getLibrarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil && req.Operation == logical.UpdateOperation {
+		return nil, fmt.Errorf("no set found to update for %s", setName)
+	} else if set == nil {
+		set = &librarySetEntry{
+			NamespaceType: NamespaceTypeOrganization,
+		}
+	}
+
+	if connection, ok := data.GetOk("connection"); ok {
+		set.Connection = connection.(string)
+	}
+
+	if set.Connection != "" {
+		config, err := getConfig(ctx, req.Storage, set.Connection)
+		if err != nil {
+			return nil, err
+		}
+
+		if config == nil {
+			return logical.ErrorResponse("connection '%s' does not exist", set.Connection), nil
+		}
+	}
+
+	if namespaceType, ok := data.GetOk("namespace_type"); ok {
+		set.NamespaceType = NamespaceType(namespaceType.(string))
+	}
+
+	if namespaceName, ok := data.GetOk("namespace_name"); ok {
+		set.NamespaceName = namespaceName.(string)
+	}
+
+	if set.NamespaceName == "" {
+		return logical.ErrorResponse("namespace_name is Required"), nil
+	}
+
+	previousRobotNames := set.RobotNames
+
+	if robotNames, ok := data.GetOk("robot_names"); ok {
+		set.RobotNames = robotNames.([]string)
+	}
+
+	if len(set.RobotNames) == 0 {
+		return logical.ErrorResponse("robot_names is Required"), nil
+	}
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		set.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		set.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+
+	if set.MaxTTL != 0 && set.TTL > set.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	if disableCheckInEnforcement, ok := data.GetOk("disable_check_in_enforcement"); ok {
+		set.DisableCheckInEnforcement = disableCheckInEnforcement.(bool)
+	}
+
+	// Robot accounts that are checked out cannot be removed from the set
+	for _, robotName := range previousRobotNames {
+		if containsString(set.RobotNames, robotName) {
+			continue
+		}
+
+		checkOut, err := b.getLibraryCheckOut(ctx, req.Storage, setName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if checkOut != nil {
+			return logical.ErrorResponse("robot account '%s' is checked out and cannot be removed from the set", robotName), nil
+		}
+	}
+
+	// Robot accounts can only belong to a single set
+	setNames, err := req.Storage.List(ctx, fmt.Sprintf("%s/", libraryStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, otherSetName := range setNames {
+		if otherSetName == setName {
+			continue
+		}
+
+		otherSet, err := b.getLibrarySet(ctx, req.Storage, otherSetName)
+		if err != nil {
+			return nil, err
+		}
+
+		if otherSet == nil || namespaceKey(otherSet.Connection, otherSet.NamespaceType, otherSet.NamespaceName) != namespaceKey(set.Connection, set.NamespaceType, set.NamespaceName) {
+			continue
+		}
+
+		for _, robotName := range set.RobotNames {
+			if containsString(otherSet.RobotNames, robotName) {
+				return logical.ErrorResponse("robot account '%s' already belongs to set '%s'", robotName, otherSetName), nil
+			}
+		}
+	}
+
+	client, err := b.getClient(ctx, req.Storage, set.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the robot accounts exist as the set does not create them
+	for _, robotName := range set.RobotNames {
+		_, _, apiError := client.GetRobotAccount(ctx, set.NamespaceType.String(), set.NamespaceName, robotName)
+		if isRobotNotFound(apiError.Error) {
+			return logical.ErrorResponse("robot account '%s' does not exist in namespace '%s'", robotName, set.NamespaceName), nil
+		} else if apiError.Error != nil {
+			return nil, apiError.Error
+		}
+	}
+
+	if err := b.saveLibrarySet(ctx, req.Storage, setName, set); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *quayBackend) pathLibrarySetDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	setName := d.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.roleLocks, librarySetLockKey(setName))
+	lock.Lock()
+	defer lock.Unlock()
+
+	checkOuts, err := b.listLibraryCheckOuts(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(checkOuts) > 0 {
+		return logical.ErrorResponse("robot accounts %v are checked out and must be checked in before the set can be deleted", checkOuts), nil
+	}
+
+	if err := req.Storage.Delete(ctx, fmt.Sprintf("%s/%s", libraryStoragePath, setName)); err != nil {
+		return nil, fmt.Errorf("error deleting set: %w", err)
+	}
+
+	return nil, nil
+}
+
+func (b *quayBackend) pathLibrarySetStatus(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	setName := d.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.roleLocks, librarySetLockKey(setName))
+	lock.RLock()
+	defer lock.RUnlock()
+
+	set, err := b.getLibrarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		return logical.ErrorResponse("No Set Found"), nil
+	}
+
+	respData := map[string]interface{}{}
+
+	for _, robotName := range set.RobotNames {
+		checkOut, err := b.getLibraryCheckOut(ctx, req.Storage, setName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		status := map[string]interface{}{
+			"available": checkOut == nil,
+		}
+
+		if checkOut != nil {
+			status["checked_out"] = checkOut.CheckedOut
+			if checkOut.BorrowerEntityID != "" {
+				status["borrower_entity_id"] = checkOut.BorrowerEntityID
+			}
+			if checkOut.BorrowerClientTokenAccessor != "" {
+				status["borrower_client_token_accessor"] = checkOut.BorrowerClientTokenAccessor
+			}
+		}
+
+		respData[robotName] = status
+	}
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *quayBackend) saveLibrarySet(ctx context.Context, s logical.Storage, setName string, set *librarySetEntry) error {
+	entry, err := logical.StorageEntryJSON(fmt.Sprintf("%s/%s", libraryStoragePath, setName), set)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func (b *quayBackend) getLibrarySet(ctx context.Context, s logical.Storage, setName string) (*librarySetEntry, error) {
+	entry, err := s.Get(ctx, fmt.Sprintf("%s/%s", libraryStoragePath, setName))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	set := new(librarySetEntry)
+	if err := entry.DecodeJSON(set); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+func libraryCheckOutStoragePath(setName string, robotName string) string {
+	return fmt.Sprintf("%s/%s/%s", libraryCheckOutsStoragePath, setName, robotName)
+}
+
+func (b *quayBackend) saveLibraryCheckOut(ctx context.Context, s logical.Storage, setName string, robotName string, checkOut *libraryCheckOutEntry) error {
+	entry, err := logical.StorageEntryJSON(libraryCheckOutStoragePath(setName, robotName), checkOut)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func (b *quayBackend) getLibraryCheckOut(ctx context.Context, s logical.Storage, setName string, robotName string) (*libraryCheckOutEntry, error) {
+	entry, err := s.Get(ctx, libraryCheckOutStoragePath(setName, robotName))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	checkOut := new(libraryCheckOutEntry)
+	if err := entry.DecodeJSON(checkOut); err != nil {
+		return nil, err
+	}
+
+	return checkOut, nil
+}
+
+func (b *quayBackend) deleteLibraryCheckOut(ctx context.Context, s logical.Storage, setName string, robotName string) error {
+	return s.Delete(ctx, libraryCheckOutStoragePath(setName, robotName))
+}
+
+// listLibraryCheckOuts returns the names of the robot accounts that are checked out from a set
+func (b *quayBackend) listLibraryCheckOuts(ctx context.Context, s logical.Storage, setName string) ([]string, error) {
+	checkOuts, err := s.List(ctx, fmt.Sprintf("%s/%s/", libraryCheckOutsStoragePath, setName))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(checkOuts)
+
+	return checkOuts, nil
+}
+
+// librarySetLockKey returns the key used to lock a set so that sets do not share locks with roles of the same name
+func librarySetLockKey(setName string) string {
+	return fmt.Sprintf("%s/%s", libraryStoragePath, setName)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func librarySetFieldSchemas() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "Name of the set",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Name",
+			},
+		},
+		"connection": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "Name of the Quay connection to use. If not set, the default connection is used",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Connection",
+			},
+		},
+		"namespace_name": {
+			Type:        framework.TypeString,
+			Description: "Name of the namespace the robot accounts belong to",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Namespace Name",
+			},
+		},
+		"namespace_type": {
+			Type:          framework.TypeString,
+			Description:   "Type of namespace the robot accounts belong to",
+			AllowedValues: []interface{}{"user", "organization"},
+			Default:       "organization",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Namespace Type",
+			},
+		},
+		"robot_names": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Short names of the existing robot accounts that can be checked out",
+			Required:    true,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Robot Names",
+			},
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Default period a robot account is checked out for. If not set or set to 0, will use system default.",
+		},
+		"max_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Maximum period a robot account can be checked out for. If not set or set to 0, will use system default.",
+		},
+		"disable_check_in_enforcement": {
+			Type:        framework.TypeBool,
+			Default:     false,
+			Description: "Allow robot accounts to be checked in by an entity other than the one that checked them out",
+		},
+	}
+}
+
+const pathLibrarySetHelpSynopsis = `Manages a set of robot accounts that can be checked out.`
+const pathLibrarySetHelpDescription = "This path allows you to read and write sets of existing Quay robot accounts that can be checked out for exclusive use."
+const pathLibrarySetListHelpSynopsis = `List existing sets.`
+const pathLibrarySetListHelpDescription = `List existing sets of robot accounts by name.`
+const pathLibrarySetStatusHelpSynopsis = `Report the availability of the robot accounts in a set.`
+const pathLibrarySetStatusHelpDescription = "This path reports whether each robot account in the set is available or checked out."
@@ -0,0 +1,391 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	librarySecretType = "quay_library_robot"
+	checkOutIDLength  = 20
+)
+
+func secretLibraryRobot(b *quayBackend) *framework.Secret {
+	return &framework.Secret{
+		Type: librarySecretType,
+		Fields: map[string]*framework.FieldSchema{
+			"username": {
+				Type:        framework.TypeString,
+				Description: "Quay robot account username",
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: "Quay robot account password",
+			},
+		},
+		Renew:  b.libraryRobotRenew,
+		Revoke: b.libraryRobotRevoke,
+	}
+}
+
+func pathLibraryCheckOut(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("%s/%s/check-out", libraryStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the set",
+					Required:    true,
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Period the robot account is checked out for. Limited by the ttl of the set",
+				},
+				"format": credentialFormatFieldSchema(),
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathLibraryCheckOut,
+			},
+			HelpSynopsis:    pathLibraryCheckOutHelpSynopsis,
+			HelpDescription: pathLibraryCheckOutHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s/check-in", libraryStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the set",
+					Required:    true,
+				},
+				"robot_names": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Robot accounts to check in. If not set, every robot account checked out by the caller is checked in",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathLibraryCheckInEnforced,
+			},
+			HelpSynopsis:    pathLibraryCheckInHelpSynopsis,
+			HelpDescription: pathLibraryCheckInHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/manage/%s/check-in", libraryStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the set",
+					Required:    true,
+				},
+				"robot_names": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Robot accounts to check in. If not set, every robot account checked out from the set is checked in",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathLibraryCheckInManaged,
+			},
+			HelpSynopsis:    pathLibraryManageCheckInHelpSynopsis,
+			HelpDescription: pathLibraryManageCheckInHelpDescription,
+		},
+	}
+}
+
+func (b *quayBackend) pathLibraryCheckOut(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	setName := data.Get("name").(string)
+
+	format, err := parseCredentialFormat(data.Get("format").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, librarySetLockKey(setName))
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := b.getLibrarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		return logical.ErrorResponse("No Set Found"), nil
+	}
+
+	ttl := set.TTL
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		requestedTTL := time.Duration(ttlRaw.(int)) * time.Second
+		if ttl == 0 || requestedTTL < ttl {
+			ttl = requestedTTL
+		}
+	}
+
+	var robotName string
+	for _, candidate := range set.RobotNames {
+		checkOut, err := b.getLibraryCheckOut(ctx, req.Storage, setName, candidate)
+		if err != nil {
+			return nil, err
+		}
+
+		if checkOut == nil {
+			robotName = candidate
+			break
+		}
+	}
+
+	if robotName == "" {
+		return logical.ErrorResponse("no robot accounts are available in set '%s'", setName), nil
+	}
+
+	config, err := getConfig(ctx, req.Storage, set.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.getClient(ctx, req.Storage, set.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	robotAccount, _, apiError := client.GetRobotAccount(ctx, set.NamespaceType.String(), set.NamespaceName, robotName)
+	if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	checkOutID, err := base62.Random(checkOutIDLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.saveLibraryCheckOut(ctx, req.Storage, setName, robotName, &libraryCheckOutEntry{
+		CheckOutID:                  checkOutID,
+		BorrowerEntityID:            req.EntityID,
+		BorrowerClientTokenAccessor: req.ClientTokenAccessor,
+		CheckedOut:                  time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	secretData := map[string]interface{}{
+		"namespace_type": set.NamespaceType,
+		"namespace_name": set.NamespaceName,
+		"robot_name":     robotName,
+		"username":       robotAccount.Name,
+		"password":       robotAccount.Token,
+	}
+
+	if err := formatCredentials(format, config, robotAccount.Name, robotAccount.Token, secretData); err != nil {
+		return nil, err
+	}
+
+	secretInternalData := map[string]interface{}{
+		"set":          setName,
+		"robot_name":   robotName,
+		"check_out_id": checkOutID,
+	}
+
+	resp := b.Secret(librarySecretType).Response(secretData, secretInternalData)
+
+	resp.Secret.Renewable = true
+
+	if ttl != 0 {
+		resp.Secret.TTL = ttl
+	}
+
+	if set.MaxTTL != 0 {
+		resp.Secret.MaxTTL = set.MaxTTL
+	}
+
+	return resp, nil
+}
+
+func (b *quayBackend) pathLibraryCheckInEnforced(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathLibraryCheckIn(ctx, req, data, true)
+}
+
+func (b *quayBackend) pathLibraryCheckInManaged(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathLibraryCheckIn(ctx, req, data, false)
+}
+
+func (b *quayBackend) pathLibraryCheckIn(ctx context.Context, req *logical.Request, data *framework.FieldData, enforce bool) (*logical.Response, error) {
+	setName := data.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.roleLocks, librarySetLockKey(setName))
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := b.getLibrarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		return logical.ErrorResponse("No Set Found"), nil
+	}
+
+	enforce = enforce && !set.DisableCheckInEnforcement
+
+	robotNames := data.Get("robot_names").([]string)
+	explicit := len(robotNames) > 0
+
+	if !explicit {
+		robotNames, err = b.listLibraryCheckOuts(ctx, req.Storage, setName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	checkedIn := []string{}
+
+	for _, robotName := range robotNames {
+		if !containsString(set.RobotNames, robotName) {
+			return logical.ErrorResponse("robot account '%s' does not belong to set '%s'", robotName, setName), nil
+		}
+
+		checkOut, err := b.getLibraryCheckOut(ctx, req.Storage, setName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if checkOut == nil {
+			continue
+		}
+
+		if enforce && !checkOut.isBorrower(req) {
+			if explicit {
+				return logical.ErrorResponse("robot account '%s' was checked out by another entity", robotName), nil
+			}
+			continue
+		}
+
+		if err := b.checkInLibraryRobot(ctx, req.Storage, setName, set, robotName); err != nil {
+			return nil, err
+		}
+
+		checkedIn = append(checkedIn, robotName)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"check_ins": checkedIn,
+		},
+	}, nil
+}
+
+func (b *quayBackend) libraryRobotRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	setRaw, ok := req.Secret.InternalData["set"]
+	if !ok {
+		return logical.ErrorResponse("internal data 'set' not found"), nil
+	}
+
+	set, err := b.getLibrarySet(ctx, req.Storage, setRaw.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		return nil, fmt.Errorf("set '%s' no longer exists", setRaw.(string))
+	}
+
+	checkOut, err := b.getLibraryCheckOut(ctx, req.Storage, setRaw.(string), req.Secret.InternalData["robot_name"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if checkOut == nil || checkOut.CheckOutID != req.Secret.InternalData["check_out_id"] {
+		return nil, fmt.Errorf("robot account has already been checked in")
+	}
+
+	resp := &logical.Response{Secret: req.Secret}
+
+	if set.TTL != 0 {
+		resp.Secret.TTL = set.TTL
+	}
+
+	if set.MaxTTL != 0 {
+		resp.Secret.MaxTTL = set.MaxTTL
+	}
+
+	return resp, nil
+}
+
+func (b *quayBackend) libraryRobotRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	setRaw, ok := req.Secret.InternalData["set"]
+	if !ok {
+		return logical.ErrorResponse("internal data 'set' not found"), nil
+	}
+
+	robotNameRaw, ok := req.Secret.InternalData["robot_name"]
+	if !ok {
+		return logical.ErrorResponse("internal data 'robot_name' not found"), nil
+	}
+
+	setName := setRaw.(string)
+	robotName := robotNameRaw.(string)
+
+	lock := locksutil.LockForKey(b.roleLocks, librarySetLockKey(setName))
+	lock.Lock()
+	defer lock.Unlock()
+
+	checkOut, err := b.getLibraryCheckOut(ctx, req.Storage, setName, robotName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The robot account has already been checked in and may have been checked out again
+	if checkOut == nil || checkOut.CheckOutID != req.Secret.InternalData["check_out_id"] {
+		return nil, nil
+	}
+
+	set, err := b.getLibrarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		return nil, b.deleteLibraryCheckOut(ctx, req.Storage, setName, robotName)
+	}
+
+	return nil, b.checkInLibraryRobot(ctx, req.Storage, setName, set, robotName)
+}
+
+// checkInLibraryRobot rotates the password of a robot account and returns it to the set. The caller must hold the lock for the set
+func (b *quayBackend) checkInLibraryRobot(ctx context.Context, s logical.Storage, setName string, set *librarySetEntry, robotName string) error {
+	client, err := b.getClient(ctx, s, set.Connection)
+	if err != nil {
+		return err
+	}
+
+	_, _, apiError := client.RegenerateRobotAccountPassword(ctx, set.NamespaceType.String(), set.NamespaceName, robotName)
+	// A robot account that no longer exists has no password left to rotate, so it is treated as checked in
+	if apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+		return apiError.Error
+	}
+
+	b.Logger().Debug("checked in robot account", "set", setName, "robot", robotName)
+
+	return b.deleteLibraryCheckOut(ctx, s, setName, robotName)
+}
+
+// isBorrower returns whether the request was made by the entity, or token when there is no entity, that checked out the robot account
+func (c *libraryCheckOutEntry) isBorrower(req *logical.Request) bool {
+	if c.BorrowerEntityID != "" {
+		return c.BorrowerEntityID == req.EntityID
+	}
+
+	return c.BorrowerClientTokenAccessor != "" && c.BorrowerClientTokenAccessor == req.ClientTokenAccessor
+}
+
+const pathLibraryCheckOutHelpSynopsis = `Check out a robot account from a set.`
+const pathLibraryCheckOutHelpDescription = "This path checks out an available robot account from the set for exclusive use until it is checked in or the lease expires."
+const pathLibraryCheckInHelpSynopsis = `Check in robot accounts to a set.`
+const pathLibraryCheckInHelpDescription = "This path rotates the password of robot accounts checked out by the caller and returns them to the set."
+const pathLibraryManageCheckInHelpSynopsis = `Check in robot accounts to a set regardless of who checked them out.`
+const pathLibraryManageCheckInHelpDescription = "This path rotates the password of checked out robot accounts and returns them to the set. It is intended for administrators."
@@ -0,0 +1,159 @@
+package quay
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+// libraryRequest performs a request against a library set on behalf of an entity
+func libraryRequest(t *testing.T, b *quayBackend, s logical.Storage, entityID string, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+		EntityID:  entityID,
+	})
+	if err != nil {
+		t.Fatalf("error performing update on %s: %v", path, err)
+	}
+
+	return resp
+}
+
+// checkOut checks out a robot account from the set on behalf of an entity
+func checkOut(t *testing.T, b *quayBackend, s logical.Storage, entityID string) *logical.Response {
+	t.Helper()
+
+	resp := libraryRequest(t, b, s, entityID, "library/my-set/check-out", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error checking out: %v", resp)
+	}
+
+	return resp
+}
+
+func TestLibraryCheckOutCheckIn(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRobot(testOrganization, "builder1")
+	server.AddRobot(testOrganization, "builder2")
+
+	writeConfig(t, b, s, "library/my-set", map[string]interface{}{
+		"namespace_name": testOrganization,
+		"robot_names":    "builder1,builder2",
+	})
+
+	alice := checkOut(t, b, s, "alice")
+	bob := checkOut(t, b, s, "bob")
+
+	if alice.Data["robot_name"] != "builder1" || bob.Data["robot_name"] != "builder2" {
+		t.Fatalf("expected builder1 and builder2 to be checked out, got %v and %v", alice.Data["robot_name"], bob.Data["robot_name"])
+	}
+
+	robot, _ := server.Robot(testOrganization, "builder1")
+	if alice.Data["password"] != robot.Token {
+		t.Fatal("expected the password of builder1 to be returned")
+	}
+
+	requireErrorResponse(t, libraryRequest(t, b, s, "carol", "library/my-set/check-out", nil), "no robot accounts are available in set 'my-set'")
+
+	// Only the borrower can check in a robot account
+	requireErrorResponse(t, libraryRequest(t, b, s, "bob", "library/my-set/check-in", map[string]interface{}{
+		"robot_names": "builder1",
+	}), "robot account 'builder1' was checked out by another entity")
+
+	resp := libraryRequest(t, b, s, "alice", "library/my-set/check-in", nil)
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 || checkIns[0] != "builder1" {
+		t.Fatalf("expected builder1 to be checked in, got %v", checkIns)
+	}
+
+	// The password is rotated when the robot account is checked in
+	if robot, _ := server.Robot(testOrganization, "builder1"); alice.Data["password"] == robot.Token {
+		t.Fatal("expected the password of builder1 to be rotated on check in")
+	}
+
+	// A later borrower is not affected by the revocation of an earlier lease
+	carol := checkOut(t, b, s, "carol")
+	if carol.Data["robot_name"] != "builder1" {
+		t.Fatalf("expected builder1 to be checked out, got %v", carol.Data["robot_name"])
+	}
+
+	revokeCredentials(t, b, s, alice.Secret)
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "library/my-set/status", nil)
+	if status := resp.Data["builder1"].(map[string]interface{}); status["available"] != false {
+		t.Fatalf("expected builder1 to remain checked out, got %v", status)
+	}
+
+	// Revoking a lease checks the robot account in
+	revokeCredentials(t, b, s, bob.Secret)
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "library/my-set/status", nil)
+	if status := resp.Data["builder2"].(map[string]interface{}); status["available"] != true {
+		t.Fatalf("expected builder2 to be available, got %v", status)
+	}
+
+	// Administrators can check in any robot account
+	resp = libraryRequest(t, b, s, "admin", "library/manage/my-set/check-in", nil)
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 || checkIns[0] != "builder1" {
+		t.Fatalf("expected builder1 to be checked in, got %v", checkIns)
+	}
+}
+
+func TestLibraryCheckInEnforcementDisabled(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRobot(testOrganization, "builder1")
+
+	writeConfig(t, b, s, "library/my-set", map[string]interface{}{
+		"namespace_name":               testOrganization,
+		"robot_names":                  "builder1",
+		"disable_check_in_enforcement": true,
+	})
+
+	checkOut(t, b, s, "alice")
+
+	resp := libraryRequest(t, b, s, "bob", "library/my-set/check-in", map[string]interface{}{
+		"robot_names": "builder1",
+	})
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 {
+		t.Fatalf("expected builder1 to be checked in by another entity, got %v", resp.Data)
+	}
+}
+
+func TestLibraryCheckInDeletedRobot(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRobot(testOrganization, "builder1")
+
+	writeConfig(t, b, s, "library/my-set", map[string]interface{}{
+		"namespace_name": testOrganization,
+		"robot_names":    "builder1",
+	})
+
+	checkOut(t, b, s, "alice")
+
+	// The robot account was deleted outside of Vault while it was checked out
+	server.InjectFailure(quaytest.Failure{Method: http.MethodPost, Path: "/api/v1/organization/example/robots/builder1/regenerate", StatusCode: http.StatusNotFound})
+
+	resp := libraryRequest(t, b, s, "alice", "library/my-set/check-in", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error checking in: %v", resp)
+	}
+
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 || checkIns[0] != "builder1" {
+		t.Fatalf("expected builder1 to be checked in, got %v", checkIns)
+	}
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "library/my-set/status", nil)
+	if status := resp.Data["builder1"].(map[string]interface{}); status["available"] != true {
+		t.Fatalf("expected builder1 to be available, got %v", status)
+	}
+}
@@ -3,6 +3,7 @@ package quay
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -16,7 +17,14 @@ type Permission string
 type TeamRole string
 type NamespaceType string
 
+var (
+	// robotNameRegex matches the short names Quay accepts for robot accounts
+	robotNameRegex = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*$`)
+)
+
 const (
+	minRobotNameLength                      = 2
+	maxRobotUsernameLength                  = 255
 	rolesStoragePath                        = "roles"
 	staticRolesStoragePath                  = "static-roles"
 	organization                            = "organization"
@@ -31,14 +39,30 @@ const (
 )
 
 type quayRoleEntry struct {
-	NamespaceType      NamespaceType          `json:"namespace_type"`
-	NamespaceName      string                 `json:"namespace_name"`
-	CreateRepositories bool                   `json:"create_repositories,omitempty"`
-	DefaultPermission  *Permission            `json:"default_permission,omitempty"`
-	Teams              *map[string]TeamRole   `json:"teams,omitempty"`
-	Repositories       *map[string]Permission `json:"repositories,omitempty"`
-	TTL                time.Duration          `json:"ttl,omitempty"`
-	MaxTTL             time.Duration          `json:"max_ttl,omitempty"`
+	Connection                string                 `json:"connection,omitempty"`
+	NamespaceType             NamespaceType          `json:"namespace_type"`
+	NamespaceName             string                 `json:"namespace_name"`
+	CreateRepositories        bool                   `json:"create_repositories,omitempty"`
+	DefaultPermission         *Permission            `json:"default_permission,omitempty"`
+	Teams                     *map[string]TeamRole   `json:"teams,omitempty"`
+	Repositories              *map[string]Permission `json:"repositories,omitempty"`
+	TTL                       time.Duration          `json:"ttl,omitempty"`
+	MaxTTL                    time.Duration          `json:"max_ttl,omitempty"`
+	RotationPeriod            time.Duration          `json:"rotation_period,omitempty"`
+	LastRotated               time.Time              `json:"last_rotated,omitempty"`
+	PoolSize                  int                    `json:"pool_size,omitempty"`
+	UsernameTemplate          string                 `json:"username_template,omitempty"`
+	RevokeOnDelete            bool                   `json:"revoke_on_delete,omitempty"`
+	ApplyToExisting           bool                   `json:"apply_to_existing,omitempty"`
+	DescriptionTemplate       string                 `json:"description_template,omitempty"`
+	RobotName                 string                 `json:"robot_name,omitempty"`
+	Adopt                     bool                   `json:"adopt,omitempty"`
+	DeleteRobot               *bool                  `json:"delete_robot_on_role_delete,omitempty"`
+	MaxIdle                   time.Duration          `json:"max_idle,omitempty"`
+	CreateMissingRepositories bool                   `json:"create_missing_repositories,omitempty"`
+	RepositoryVisibility      string                 `json:"repository_visibility,omitempty"`
+	RepositoryDescription     string                 `json:"repository_description,omitempty"`
+	StrictRepositories        bool                   `json:"strict_repositories,omitempty"`
 }
 
 type quayPermission struct {
@@ -71,7 +95,7 @@ func pathRole(b *quayBackend) []*framework.Path {
 		},
 		{
 			Pattern: fmt.Sprintf("%s/%s", staticRolesStoragePath, framework.GenericNameRegex("name")),
-			Fields:  defaultFieldSchemas(),
+			Fields:  staticRoleFieldSchemas(),
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.ReadOperation: &framework.PathOperation{
 					Callback: b.pathRolesRead,
@@ -140,6 +164,7 @@ func (b *quayBackend) pathRolesRead(ctx context.Context, req *logical.Request, d
 	}
 
 	respData := map[string]interface{}{
+		"connection":          entry.Connection,
 		"namespace_name":      entry.NamespaceName,
 		"namespace_type":      entry.NamespaceType,
 		"create_repositories": entry.CreateRepositories,
@@ -157,9 +182,27 @@ func (b *quayBackend) pathRolesRead(ctx context.Context, req *logical.Request, d
 		respData["teams"] = entry.Teams
 	}
 
+	respData["description_template"] = entry.descriptionTemplate()
+	respData["max_idle"] = entry.MaxIdle.Seconds()
+	respData["create_missing_repositories"] = entry.CreateMissingRepositories
+	respData["repository_visibility"] = entry.repositoryVisibility()
+	respData["repository_description"] = entry.RepositoryDescription
+	respData["strict_repositories"] = entry.StrictRepositories
+
 	if storagePath == rolesStoragePath {
 		respData["ttl"] = entry.TTL.Seconds()
 		respData["max_ttl"] = entry.MaxTTL.Seconds()
+		respData["pool_size"] = entry.PoolSize
+		respData["username_template"] = entry.usernameTemplate()
+		respData["revoke_on_delete"] = entry.RevokeOnDelete
+		respData["apply_to_existing"] = entry.ApplyToExisting
+	}
+
+	if storagePath == staticRolesStoragePath {
+		respData["rotation_period"] = entry.RotationPeriod.Seconds()
+		respData["robot_name"] = entry.staticRobotName(d.Get("name").(string))
+		respData["adopt"] = entry.Adopt
+		respData["delete_robot_on_role_delete"] = entry.deleteRobotOnRoleDelete()
 	}
 
 	return &logical.Response{
@@ -173,16 +216,43 @@ func (b *quayBackend) pathRolesWrite(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("name is required"), nil
 	}
 
+	// Rotations record when they happened on the role, so the role is not written while a rotation is in progress
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
 	roleEntry, err := b.getRole(ctx, getStoragePath(req), roleName, req.Storage)
 	if err != nil {
 		return nil, err
 	}
+
+	// The stored role is read again as roleEntry is updated in place
+	previousRole, err := b.getRole(ctx, getStoragePath(req), roleName, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
 	if roleEntry == nil && req.Operation == logical.UpdateOperation {
 		return nil, fmt.Errorf("no role found to update for %s", roleName)
 	} else if roleEntry == nil {
 		roleEntry = &quayRoleEntry{}
 	}
 
+	if connection, ok := data.GetOk("connection"); ok {
+		roleEntry.Connection = connection.(string)
+	}
+
+	if roleEntry.Connection != "" {
+		config, err := getConfig(ctx, req.Storage, roleEntry.Connection)
+		if err != nil {
+			return nil, err
+		}
+
+		if config == nil {
+			return logical.ErrorResponse("connection '%s' does not exist", roleEntry.Connection), nil
+		}
+	}
+
 	namespaceType := data.Get("namespace_type")
 	roleEntry.NamespaceType = NamespaceType(namespaceType.(string))
 
@@ -209,6 +279,9 @@ func (b *quayBackend) pathRolesWrite(ctx context.Context, req *logical.Request,
 		if err != nil {
 			return logical.ErrorResponse("error parsing repositories '%s': %s", repositoriesRaw.(string), err.Error()), nil
 		}
+		if err := validateRepositoryPatterns(parsedRepositories); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 		roleEntry.Repositories = &parsedRepositories
 	}
 
@@ -221,6 +294,36 @@ func (b *quayBackend) pathRolesWrite(ctx context.Context, req *logical.Request,
 		roleEntry.Teams = &parsedTeams
 	}
 
+	if createMissingRepositoriesRaw, ok := data.GetOk("create_missing_repositories"); ok {
+		roleEntry.CreateMissingRepositories = createMissingRepositoriesRaw.(bool)
+	}
+
+	if repositoryVisibilityRaw, ok := data.GetOk("repository_visibility"); ok {
+		roleEntry.RepositoryVisibility = repositoryVisibilityRaw.(string)
+	}
+
+	if roleEntry.RepositoryVisibility != "" && roleEntry.RepositoryVisibility != "private" && roleEntry.RepositoryVisibility != "public" {
+		return logical.ErrorResponse("repository_visibility must be 'private' or 'public'"), nil
+	}
+
+	if repositoryDescriptionRaw, ok := data.GetOk("repository_description"); ok {
+		roleEntry.RepositoryDescription = repositoryDescriptionRaw.(string)
+	}
+
+	if strictRepositoriesRaw, ok := data.GetOk("strict_repositories"); ok {
+		roleEntry.StrictRepositories = strictRepositoriesRaw.(bool)
+	}
+
+	if roleEntry.StrictRepositories && roleEntry.CreateMissingRepositories {
+		return logical.ErrorResponse("strict_repositories and create_missing_repositories cannot both be set"), nil
+	}
+
+	if roleEntry.NamespaceType == NamespaceTypeUser {
+		if resp, err := b.validateUserNamespace(ctx, req, roleEntry); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
 	if ttlRaw, ok := data.GetOk("ttl"); ok {
 		roleEntry.TTL = time.Duration(ttlRaw.(int)) * time.Second
 	}
@@ -233,10 +336,96 @@ func (b *quayBackend) pathRolesWrite(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
 	}
 
+	if poolSizeRaw, ok := data.GetOk("pool_size"); ok {
+		roleEntry.PoolSize = poolSizeRaw.(int)
+	}
+
+	if roleEntry.PoolSize < 0 {
+		return logical.ErrorResponse("pool_size cannot be negative"), nil
+	}
+
+	if applyToExistingRaw, ok := data.GetOk("apply_to_existing"); ok {
+		roleEntry.ApplyToExisting = applyToExistingRaw.(bool)
+	}
+
+	if revokeOnDeleteRaw, ok := data.GetOk("revoke_on_delete"); ok {
+		roleEntry.RevokeOnDelete = revokeOnDeleteRaw.(bool)
+	}
+
+	if usernameTemplateRaw, ok := data.GetOk("username_template"); ok {
+		roleEntry.UsernameTemplate = usernameTemplateRaw.(string)
+	}
+
+	if descriptionTemplateRaw, ok := data.GetOk("description_template"); ok {
+		roleEntry.DescriptionTemplate = descriptionTemplateRaw.(string)
+	}
+
+	if _, err := roleEntry.robotAccountRequest(roleName, req); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if getStoragePath(req) == rolesStoragePath {
+		if err := roleEntry.validateUsernameTemplate(roleName); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if rotationPeriodRaw, ok := data.GetOk("rotation_period"); ok {
+		roleEntry.RotationPeriod = time.Duration(rotationPeriodRaw.(int)) * time.Second
+	}
+
+	if roleEntry.RotationPeriod < 0 {
+		return logical.ErrorResponse("rotation_period cannot be negative"), nil
+	}
+
+	if maxIdleRaw, ok := data.GetOk("max_idle"); ok {
+		roleEntry.MaxIdle = time.Duration(maxIdleRaw.(int)) * time.Second
+	}
+
+	if roleEntry.MaxIdle < 0 {
+		return logical.ErrorResponse("max_idle cannot be negative"), nil
+	}
+
+	if roleEntry.StrictRepositories {
+		if resp, err := b.validateRepositoriesExist(ctx, req, roleEntry); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
+	if getStoragePath(req) == staticRolesStoragePath {
+		if resp, err := b.validateStaticRobot(ctx, req, roleName, roleEntry, data); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
 	if err := b.saveRole(ctx, req.Storage, roleEntry, getStoragePath(req), roleName); err != nil {
 		return nil, err
 	}
 
+	if getStoragePath(req) == rolesStoragePath {
+		// Pooled robot accounts provisioned for the previous version of the role are only replaced when they no longer match it
+		if provisioningUnchanged(previousRole, roleEntry) {
+			b.requestPoolRefill(roleName)
+		} else if err := b.replaceRobotPool(ctx, req.Storage, roleName); err != nil {
+			return nil, err
+		}
+	}
+
+	if getStoragePath(req) == rolesStoragePath && roleEntry.ApplyToExisting && req.Operation == logical.UpdateOperation {
+		warnings, err := b.applyRoleToDynamicRobots(ctx, req.Storage, roleName, roleEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(warnings) > 0 {
+			resp := &logical.Response{}
+			for _, warning := range warnings {
+				resp.AddWarning(warning)
+			}
+			return resp, nil
+		}
+	}
+
 	return nil, nil
 
 }
@@ -263,16 +452,36 @@ func (b *quayBackend) pathRolesDelete(ctx context.Context, req *logical.Request,
 			return nil, nil
 		}
 
-		client, err := b.getClient(ctx, req.Storage)
+		client, err := b.getClient(ctx, req.Storage, roleEntry.Connection)
 		if err != nil {
 			return nil, err
 		}
 
-		err = b.deleteRobot(client, roleName, roleEntry)
+		// Robot accounts relied upon by other systems are kept but removed from the teams of the role
+		err = b.releaseRobot(ctx, client, roleEntry.staticRobotName(roleName), roleEntry.NamespaceType, roleEntry.NamespaceName, b.assembleTeamNames(roleEntry), roleEntry.deleteRobotOnRoleDelete())
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if storagePath == rolesStoragePath {
+		// Delete the robot accounts waiting to be leased
+		if err := b.drainRobotPool(ctx, req.Storage, roleName); err != nil {
+			return nil, err
+		}
 
+		roleEntry, err := b.getRole(ctx, storagePath, roleName, req.Storage)
 		if err != nil {
 			return nil, err
 		}
+
+		// Delete the robot accounts with outstanding leases
+		if roleEntry != nil && roleEntry.RevokeOnDelete {
+			if err := b.revokeDynamicRobots(ctx, req.Storage, roleName); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	err := req.Storage.Delete(ctx, fmt.Sprintf("%s/%s", getStoragePath(req), roleName))
@@ -319,6 +528,137 @@ func getStoragePath(req *logical.Request) string {
 
 }
 
+// staticRobotName returns the short name of the robot account managed by a static role
+func (role *quayRoleEntry) staticRobotName(roleName string) string {
+	if role.RobotName != "" {
+		return role.RobotName
+	}
+
+	return roleName
+}
+
+// validateRobotName verifies that Quay accepts the short name of a robot account within a namespace
+func validateRobotName(namespaceName string, robotName string) error {
+	if !robotNameRegex.MatchString(robotName) {
+		return fmt.Errorf("robot account name '%s' must match %s", robotName, robotNameRegex.String())
+	}
+
+	if len(robotName) < minRobotNameLength {
+		return fmt.Errorf("robot account name '%s' must be at least %d characters", robotName, minRobotNameLength)
+	}
+
+	if username := robotAccountName(namespaceName, robotName); len(username) > maxRobotUsernameLength {
+		return fmt.Errorf("robot account username '%s' must not exceed %d characters", username, maxRobotUsernameLength)
+	}
+
+	return nil
+}
+
+// deleteRobotOnRoleDelete returns whether the robot account of a static role is deleted along with the role.
+// Adopted robot accounts are kept unless requested otherwise
+func (role *quayRoleEntry) deleteRobotOnRoleDelete() bool {
+	if role.DeleteRobot != nil {
+		return *role.DeleteRobot
+	}
+
+	return !role.Adopt
+}
+
+// validateUserNamespace verifies that a role for a user namespace only uses options Quay supports for users.
+// Quay only manages the robot accounts of the authenticated user, so the namespace must be that user
+func (b *quayBackend) validateUserNamespace(ctx context.Context, req *logical.Request, roleEntry *quayRoleEntry) (*logical.Response, error) {
+	if roleEntry.Teams != nil && len(*roleEntry.Teams) > 0 {
+		return logical.ErrorResponse("teams are not supported for user namespaces"), nil
+	}
+
+	if roleEntry.CreateRepositories {
+		return logical.ErrorResponse("create_repositories is not supported for user namespaces"), nil
+	}
+
+	client, err := b.getClient(ctx, req.Storage, roleEntry.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	user, _, apiError := client.GetCurrentUser(ctx)
+	if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	if user.Username != roleEntry.NamespaceName {
+		return logical.ErrorResponse("namespace_name must be '%s', the user the connection authenticates as, for user namespaces", user.Username), nil
+	}
+
+	return nil, nil
+}
+
+// validateStaticRobot applies the robot account options of a static role and verifies that the robot account
+// is not managed by another static role and, when adopted, that it exists
+func (b *quayBackend) validateStaticRobot(ctx context.Context, req *logical.Request, roleName string, roleEntry *quayRoleEntry, data *framework.FieldData) (*logical.Response, error) {
+
+	if robotNameRaw, ok := data.GetOk("robot_name"); ok {
+		robotName := robotNameRaw.(string)
+
+		if req.Operation == logical.UpdateOperation && robotName != roleEntry.staticRobotName(roleName) {
+			return logical.ErrorResponse("robot_name cannot be changed once the role has been created"), nil
+		}
+
+		if err := validateRobotName(roleEntry.NamespaceName, robotName); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		roleEntry.RobotName = robotName
+	}
+
+	if adoptRaw, ok := data.GetOk("adopt"); ok {
+		roleEntry.Adopt = adoptRaw.(bool)
+	}
+
+	if deleteRobotRaw, ok := data.GetOk("delete_robot_on_role_delete"); ok {
+		deleteRobot := deleteRobotRaw.(bool)
+		roleEntry.DeleteRobot = &deleteRobot
+	}
+
+	robotName := roleEntry.staticRobotName(roleName)
+	robotKey := namespaceKey(roleEntry.Connection, roleEntry.NamespaceType, roleEntry.NamespaceName)
+
+	roleNames, err := req.Storage.List(ctx, fmt.Sprintf("%s/", staticRolesStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, otherRoleName := range roleNames {
+		if otherRoleName == roleName {
+			continue
+		}
+
+		otherRole, err := b.getRole(ctx, staticRolesStoragePath, otherRoleName, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+
+		if otherRole != nil && otherRole.staticRobotName(otherRoleName) == robotName && namespaceKey(otherRole.Connection, otherRole.NamespaceType, otherRole.NamespaceName) == robotKey {
+			return logical.ErrorResponse("robot account '%s' is already managed by static role '%s'", robotName, otherRoleName), nil
+		}
+	}
+
+	if roleEntry.Adopt {
+		client, err := b.getClient(ctx, req.Storage, roleEntry.Connection)
+		if err != nil {
+			return nil, err
+		}
+
+		_, _, apiError := client.GetRobotAccount(ctx, roleEntry.NamespaceType.String(), roleEntry.NamespaceName, robotName)
+		if isRobotNotFound(apiError.Error) {
+			return logical.ErrorResponse("robot account '%s' does not exist in namespace '%s' and cannot be adopted", robotName, roleEntry.NamespaceName), nil
+		} else if apiError.Error != nil {
+			return nil, apiError.Error
+		}
+	}
+
+	return nil, nil
+}
+
 func defaultFieldSchemas() map[string]*framework.FieldSchema {
 
 	return map[string]*framework.FieldSchema{
@@ -330,6 +670,13 @@ func defaultFieldSchemas() map[string]*framework.FieldSchema {
 				Name: "Name",
 			},
 		},
+		"connection": {
+			Type:        framework.TypeLowerCaseString,
+			Description: "Name of the Quay connection to use. If not set, the default connection is used",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Connection",
+			},
+		},
 		"namespace_name": {
 			Type:        framework.TypeString,
 			Description: "Name of the namespace the robot account should be placed within",
@@ -365,7 +712,7 @@ func defaultFieldSchemas() map[string]*framework.FieldSchema {
 		},
 		"repositories": {
 			Type:        framework.TypeString,
-			Description: "Permissions to apply to repositories",
+			Description: "Permissions to apply to repositories. Keys may be repository names, glob patterns or regular expressions anchored with ^ and $",
 			DisplayAttrs: &framework.DisplayAttributes{
 				Name: "Repositories",
 			},
@@ -377,6 +724,49 @@ func defaultFieldSchemas() map[string]*framework.FieldSchema {
 				Name: "Repositories",
 			},
 		},
+		"description_template": {
+			Type:        framework.TypeString,
+			Description: "Template used to describe robot accounts created for the role. May reference .RoleName, .EntityID, .DisplayName, .MountAccessor and .RequestID. Defaults to " + defaultDescriptionTemplate,
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Description Template",
+			},
+		},
+		"max_idle": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Time a robot account may go unused before it is revoked, or for static roles before its password is rotated. If not set or set to 0, idle robot accounts are kept.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Max Idle",
+			},
+		},
+		"create_missing_repositories": {
+			Type:        framework.TypeBool,
+			Description: "Create the repositories named in repositories that do not exist when provisioning a robot account. Glob and regular expression keys are never created",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Create Missing Repositories",
+			},
+		},
+		"repository_visibility": {
+			Type:          framework.TypeString,
+			Description:   "Visibility of the repositories created for the role. Defaults to " + defaultRepositoryVisibility,
+			AllowedValues: []interface{}{"private", "public"},
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Repository Visibility",
+			},
+		},
+		"repository_description": {
+			Type:        framework.TypeString,
+			Description: "Description of the repositories created for the role",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Repository Description",
+			},
+		},
+		"strict_repositories": {
+			Type:        framework.TypeBool,
+			Description: "Reject role writes that name repositories that do not exist in the namespace",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name: "Strict Repositories",
+			},
+		},
 	}
 
 }
@@ -394,9 +784,55 @@ func dynamicRoleFieldSchemas() map[string]*framework.FieldSchema {
 		Description: "Maximum time for role. If not set or set to 0, will use system default.",
 	}
 
+	dynamicRoleFieldSchemas["username_template"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Template used to name robot accounts. May reference .RoleName and .DisplayName and use the random, unix_time and other template functions. Must use random or unix_time. Defaults to " + defaultUsernameTemplate,
+	}
+
+	dynamicRoleFieldSchemas["apply_to_existing"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Apply changes to the role to the robot accounts of every outstanding lease, removing grants the role no longer makes.",
+	}
+
+	dynamicRoleFieldSchemas["revoke_on_delete"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Delete the robot accounts of every outstanding lease when the role is deleted.",
+	}
+
+	dynamicRoleFieldSchemas["pool_size"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "Number of provisioned robot accounts kept ready to be leased. If not set or set to 0, robot accounts are provisioned when credentials are requested.",
+	}
+
 	return dynamicRoleFieldSchemas
 }
 
+func staticRoleFieldSchemas() map[string]*framework.FieldSchema {
+	staticRoleFieldSchemas := defaultFieldSchemas()
+
+	staticRoleFieldSchemas["rotation_period"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "Period after which the password of the robot account is rotated automatically. If not set or set to 0, the password is only rotated manually.",
+	}
+
+	staticRoleFieldSchemas["robot_name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Short name of the robot account managed by the role. If not set, the name of the role is used.",
+	}
+
+	staticRoleFieldSchemas["adopt"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Only manage an existing robot account. The robot account is never created by the role.",
+	}
+
+	staticRoleFieldSchemas["delete_robot_on_role_delete"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Delete the robot account when the role is deleted. Defaults to true unless adopt is set.",
+	}
+
+	return staticRoleFieldSchemas
+}
+
 func (n *NamespaceType) String() string {
 	return string(*n)
 }
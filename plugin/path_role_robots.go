@@ -0,0 +1,285 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+func pathRoleRobots(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("%s/%s/robots/?$", rolesStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the role",
+					Required:    true,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.pathRoleRobotsList,
+			},
+
+			HelpSynopsis:    pathRoleRobotsHelpSynopsis,
+			HelpDescription: pathRoleRobotsHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s/robot", staticRolesStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the role",
+					Required:    true,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathStaticRoleRobotRead,
+			},
+
+			HelpSynopsis:    pathStaticRoleRobotHelpSynopsis,
+			HelpDescription: pathStaticRoleRobotHelpDescription,
+		},
+	}
+}
+
+func (b *quayBackend) pathRoleRobotsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+
+	role, err := b.getRole(ctx, rolesStoragePath, roleName, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return logical.ErrorResponse("No Role Found"), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	issuedRobots := []*dynamicRobotEntry{}
+	pooled := map[string]bool{}
+
+	robotNames, err := b.listDynamicRobots(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, robotName := range robotNames {
+		dynamicRobot, err := b.getDynamicRobot(ctx, req.Storage, roleName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if dynamicRobot != nil {
+			issuedRobots = append(issuedRobots, dynamicRobot)
+		}
+	}
+
+	pooledRobotNames, err := b.listPooledRobots(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, robotName := range pooledRobotNames {
+		pooledRobot, err := b.getPooledRobot(ctx, req.Storage, roleName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if pooledRobot != nil {
+			issuedRobots = append(issuedRobots, &pooledRobot.dynamicRobotEntry)
+			pooled[robotName] = true
+		}
+	}
+
+	keys := []string{}
+	keyInfo := map[string]interface{}{}
+
+	// Every robot account in the namespace of the role is listed
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	robots, _, apiError := client.ListRobotAccounts(ctx, role.NamespaceType.String(), role.NamespaceName, &qc.ListRobotAccountsOptions{
+		Permissions: true,
+	})
+	if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	roleNamespaceKey := namespaceKey(role.Connection, role.NamespaceType, role.NamespaceName)
+	namespaceRobots := map[string][]qc.RobotAccount{roleNamespaceKey: robots}
+
+	for _, robot := range robots {
+		info := inspectRobot(role.NamespaceName, robotShortName(robot.Name), robots)
+		info["issued"] = false
+		info["pooled"] = false
+
+		keys = append(keys, robot.Name)
+		keyInfo[robot.Name] = info
+	}
+
+	// Robot accounts issued by the role are marked, including those issued before the namespace of the role changed
+	for _, issuedRobot := range issuedRobots {
+		robotNamespaceKey := namespaceKey(issuedRobot.Connection, issuedRobot.NamespaceType, issuedRobot.NamespaceName)
+
+		client, err := b.getClient(ctx, req.Storage, issuedRobot.Connection)
+		if err != nil {
+			return nil, err
+		}
+
+		robots, ok := namespaceRobots[robotNamespaceKey]
+		if !ok {
+			var apiError qc.QuayApiError
+			robots, _, apiError = client.ListRobotAccounts(ctx, issuedRobot.NamespaceType.String(), issuedRobot.NamespaceName, &qc.ListRobotAccountsOptions{
+				Permissions: true,
+			})
+			if apiError.Error != nil {
+				return nil, apiError.Error
+			}
+			namespaceRobots[robotNamespaceKey] = robots
+		}
+
+		username := robotAccountName(issuedRobot.NamespaceName, issuedRobot.RobotName)
+
+		info := inspectRobot(issuedRobot.NamespaceName, issuedRobot.RobotName, robots)
+		if err := inspectRobotPermissions(ctx, client, issuedRobot.NamespaceType, issuedRobot.NamespaceName, issuedRobot.RobotName, info); err != nil {
+			return nil, err
+		}
+
+		info["issued"] = true
+		info["pooled"] = pooled[issuedRobot.RobotName]
+		info["issued_at"] = issuedRobot.Created
+
+		if issuedRobot.Scope != nil && !issuedRobot.Scope.isEmpty() {
+			info["scope"] = issuedRobot.Scope
+		}
+
+		if !issuedRobot.IdleRevoked.IsZero() {
+			info["idle_revoked"] = issuedRobot.IdleRevoked
+		}
+
+		if _, ok := keyInfo[username]; !ok {
+			keys = append(keys, username)
+		}
+		keyInfo[username] = info
+	}
+
+	sort.Strings(keys)
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *quayBackend) pathStaticRoleRobotRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+
+	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return logical.ErrorResponse("No Static Role Found"), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	robots, _, apiError := client.ListRobotAccounts(ctx, role.NamespaceType.String(), role.NamespaceName, &qc.ListRobotAccountsOptions{
+		Permissions: true,
+	})
+	if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	info := inspectRobot(role.NamespaceName, role.staticRobotName(roleName), robots)
+	if err := inspectRobotPermissions(ctx, client, role.NamespaceType, role.NamespaceName, role.staticRobotName(roleName), info); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: info,
+	}, nil
+}
+
+// inspectRobot returns the creation date, last access, teams and repositories of a robot account.
+// robots holds the robot accounts of the namespace listed with their permissions, which name the
+// repositories a robot account can access but not its role on them, see inspectRobotPermissions
+func inspectRobot(namespaceName string, robotName string, robots []qc.RobotAccount) map[string]interface{} {
+	username := robotAccountName(namespaceName, robotName)
+
+	for _, robot := range robots {
+		if robot.Name != username {
+			continue
+		}
+
+		teams := []string{}
+		for _, team := range robot.Teams {
+			teams = append(teams, team.Name)
+		}
+
+		repositories := []string{}
+		repositories = append(repositories, robot.Repositories...)
+
+		return map[string]interface{}{
+			"username":      username,
+			"exists":        true,
+			"description":   robot.Description,
+			"created":       robot.Created,
+			"last_accessed": robot.LastAccessed,
+			"teams":         teams,
+			"repositories":  repositories,
+		}
+	}
+
+	return map[string]interface{}{
+		"username": username,
+		"exists":   false,
+	}
+}
+
+// inspectRobotPermissions adds the role of a robot account on each repository it can access to the details returned
+// by inspectRobot. Robot accounts that do not exist, including those deleted since they were listed, are left as is
+func inspectRobotPermissions(ctx context.Context, client *client, namespaceType NamespaceType, namespaceName string, robotName string, info map[string]interface{}) error {
+	if info["exists"] != true {
+		return nil
+	}
+
+	robotPermissions, _, apiError := client.GetRobotPermissions(ctx, namespaceType.String(), namespaceName, robotName)
+	if apiError.Error != nil {
+		if isRobotNotFound(apiError.Error) {
+			return nil
+		}
+
+		return apiError.Error
+	}
+
+	permissions := map[string]string{}
+	for _, permission := range robotPermissions.Permissions {
+		permissions[permission.Repository.Name] = permission.Role.String()
+	}
+
+	info["permissions"] = permissions
+
+	return nil
+}
+
+const pathRoleRobotsHelpSynopsis = `List the robot accounts in the namespace of a dynamic role.`
+const pathRoleRobotsHelpDescription = "This path lists every robot account in the namespace of a dynamic role along with its creation date, last access, teams and repositories in Quay. Robot accounts with outstanding leases and pooled robot accounts of the role are marked as issued, including those in a previous namespace of the role, and also report their permission on each repository."
+const pathStaticRoleRobotHelpSynopsis = `Inspect the robot account of a static role.`
+const pathStaticRoleRobotHelpDescription = "This path returns the creation date, last access, teams, repositories and repository permissions in Quay of the robot account managed by a static role."
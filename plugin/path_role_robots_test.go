@@ -0,0 +1,143 @@
+package quay
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRoleRobotsList(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+	server.SetPageSize(1)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories": `{"api": "write"}`,
+		"teams":        `{"developers": "member"}`,
+	})
+
+	usernames := []string{}
+	for i := 0; i < 2; i++ {
+		resp, _ := readCredentials(t, b, s, "test", testOrganization)
+		usernames = append(usernames, resp.Data["username"].(string))
+	}
+
+	// Robot accounts not issued by the role are listed but not marked as issued
+	server.AddRobot(testOrganization, "unrelated")
+
+	requestCount := len(server.Requests())
+
+	resp := handleRequest(t, b, s, logical.ListOperation, "roles/test/robots", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error listing robot accounts: %v", resp)
+	}
+
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != len(usernames)+1 {
+		t.Fatalf("expected robot accounts %v and 'unrelated', got %v", usernames, keys)
+	}
+
+	keyInfo := resp.Data["key_info"].(map[string]interface{})
+
+	for _, username := range usernames {
+		info, ok := keyInfo[username].(map[string]interface{})
+		if !ok {
+			t.Fatalf("robot account '%s' is not listed", username)
+		}
+
+		if info["exists"] != true || info["issued"] != true || info["pooled"] != false || info["created"] == "" {
+			t.Fatalf("unexpected details for robot account '%s': %v", username, info)
+		}
+
+		if teams := info["teams"].([]string); !reflect.DeepEqual(teams, []string{"developers"}) {
+			t.Fatalf("expected teams [developers] for robot account '%s', got %v", username, teams)
+		}
+
+		if repositories := info["repositories"].([]string); !reflect.DeepEqual(repositories, []string{"api"}) {
+			t.Fatalf("expected repositories [api] for robot account '%s', got %v", username, repositories)
+		}
+
+		if permissions := info["permissions"].(map[string]string); !reflect.DeepEqual(permissions, map[string]string{"api": "write"}) {
+			t.Fatalf("expected permissions map[api:write] for robot account '%s', got %v", username, permissions)
+		}
+	}
+
+	if info := keyInfo[testOrganization+"+unrelated"].(map[string]interface{}); info["exists"] != true || info["issued"] != false || info["permissions"] != nil {
+		t.Fatalf("unexpected details for robot account 'unrelated': %v", info)
+	}
+
+	// Permissions are only read for the robot accounts issued by the role
+	permissionRequests := 0
+	for _, request := range server.Requests()[requestCount:] {
+		if strings.HasSuffix(request, "/permissions") {
+			if strings.Contains(request, "/unrelated/") {
+				t.Fatalf("unexpected request '%s'", request)
+			}
+
+			permissionRequests++
+		}
+	}
+
+	if permissionRequests != len(usernames) {
+		t.Fatalf("expected permissions to be read for %d robot accounts, got %d", len(usernames), permissionRequests)
+	}
+}
+
+func TestRoleRobotsListPreviousNamespace(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	_, robotName := readCredentials(t, b, s, "test", testOrganization)
+	server.AddRobot(testOrganization, "unrelated")
+
+	handleRequest(t, b, s, logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"namespace_type": string(NamespaceTypeUser),
+		"namespace_name": testUsername,
+	})
+
+	resp := handleRequest(t, b, s, logical.ListOperation, "roles/test/robots", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error listing robot accounts: %v", resp)
+	}
+
+	// Only the issued robot accounts of the previous namespace are listed
+	username := robotAccountName(testOrganization, robotName)
+	if keys := resp.Data["keys"].([]string); !reflect.DeepEqual(keys, []string{username}) {
+		t.Fatalf("expected robot accounts [%s], got %v", username, keys)
+	}
+}
+
+func TestStaticRoleRobotRead(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+
+	writeRole(t, b, s, "static-roles/test", map[string]interface{}{
+		"repositories": `{"api": "read"}`,
+	})
+
+	// The robot account is created when the credentials are first read
+	resp := handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/robot", nil)
+	if resp == nil || resp.IsError() || resp.Data["username"] != testOrganization+"+test" || resp.Data["exists"] != false {
+		t.Fatalf("unexpected robot account details: %v", resp)
+	}
+
+	readStaticCredentials(t, b, s, "test")
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/robot", nil)
+	if resp == nil || resp.IsError() || resp.Data["exists"] != true {
+		t.Fatalf("unexpected robot account details: %v", resp)
+	}
+
+	if repositories := resp.Data["repositories"].([]string); !reflect.DeepEqual(repositories, []string{"api"}) {
+		t.Fatalf("expected repositories [api], got %v", repositories)
+	}
+
+	if permissions := resp.Data["permissions"].(map[string]string); !reflect.DeepEqual(permissions, map[string]string{"api": "read"}) {
+		t.Fatalf("expected permissions map[api:read], got %v", permissions)
+	}
+}
@@ -0,0 +1,207 @@
+package quay
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+func TestRoleUserNamespaceValidation(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	for _, path := range []string{"roles/test", "static-roles/test"} {
+		writeRole(t, b, s, path, map[string]interface{}{
+			"namespace_type": string(NamespaceTypeUser),
+			"namespace_name": testUsername,
+			"repositories":   `{"api": "write"}`,
+		})
+
+		writeRoleError(t, b, s, path, map[string]interface{}{
+			"namespace_type": string(NamespaceTypeUser),
+			"namespace_name": testUsername,
+			"teams":          `{"developers": "member"}`,
+		}, "teams are not supported for user namespaces")
+
+		writeRoleError(t, b, s, path, map[string]interface{}{
+			"namespace_type":      string(NamespaceTypeUser),
+			"namespace_name":      testUsername,
+			"create_repositories": true,
+		}, "create_repositories is not supported for user namespaces")
+
+		writeRoleError(t, b, s, path, map[string]interface{}{
+			"namespace_type": string(NamespaceTypeUser),
+			"namespace_name": "bob",
+		}, "namespace_name must be 'alice'")
+	}
+}
+
+func TestStaticRoleCreatesRobot(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "static-roles/test", map[string]interface{}{
+		"robot_name": "deployer",
+	})
+
+	resp := readStaticCredentials(t, b, s, "test")
+
+	robot, ok := server.Robot(testOrganization, "deployer")
+	if !ok {
+		t.Fatal("robot account 'deployer' was not created")
+	}
+
+	if resp.Data["username"] != robot.Name || resp.Data["password"] != robot.Token {
+		t.Fatalf("expected credentials of '%s', got %v", robot.Name, resp.Data["username"])
+	}
+
+	handleRequest(t, b, s, logical.DeleteOperation, "static-roles/test", nil)
+
+	requireRobot(t, server, testOrganization, "deployer", false)
+}
+
+func TestStaticRoleAdopt(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRoleError(t, b, s, "static-roles/missing", map[string]interface{}{
+		"robot_name": "deployer",
+		"adopt":      true,
+	}, "cannot be adopted")
+
+	existing := server.AddRobot(testOrganization, "deployer")
+	server.AddRobot(testOrganization, "builder")
+
+	writeRole(t, b, s, "static-roles/deployer", map[string]interface{}{
+		"robot_name": "deployer",
+		"adopt":      true,
+	})
+	writeRole(t, b, s, "static-roles/builder", map[string]interface{}{
+		"robot_name":                  "builder",
+		"adopt":                       true,
+		"delete_robot_on_role_delete": true,
+	})
+
+	// Adopted robot accounts keep their password
+	if resp := readStaticCredentials(t, b, s, "deployer"); resp.Data["password"] != existing.Token {
+		t.Fatal("expected the password of the adopted robot account to be kept")
+	}
+
+	handleRequest(t, b, s, logical.DeleteOperation, "static-roles/deployer", nil)
+	handleRequest(t, b, s, logical.DeleteOperation, "static-roles/builder", nil)
+
+	requireRobot(t, server, testOrganization, "deployer", true)
+	requireRobot(t, server, testOrganization, "builder", false)
+}
+
+func TestStaticRoleRobotNameValidation(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRobot(testOrganization, "deployer")
+
+	writeRole(t, b, s, "static-roles/deployer", map[string]interface{}{
+		"robot_name": "deployer",
+		"adopt":      true,
+	})
+
+	// A robot account is managed by a single static role
+	writeRoleError(t, b, s, "static-roles/other", map[string]interface{}{
+		"robot_name": "deployer",
+		"adopt":      true,
+	}, "robot account 'deployer' is already managed by static role 'deployer'")
+
+	// The same robot name in another namespace is a different robot account
+	writeRole(t, b, s, "static-roles/user", map[string]interface{}{
+		"namespace_type": string(NamespaceTypeUser),
+		"namespace_name": testUsername,
+		"robot_name":     "deployer",
+	})
+
+	requireErrorResponse(t, handleRequest(t, b, s, logical.UpdateOperation, "static-roles/deployer", map[string]interface{}{
+		"robot_name": "builder",
+	}), "robot_name cannot be changed once the role has been created")
+
+	writeRoleError(t, b, s, "static-roles/invalid", map[string]interface{}{
+		"robot_name": "Not-Valid",
+	}, "Not-Valid")
+
+	// The default robot name is the name of the role, which is validated in the same way
+	writeRoleError(t, b, s, "static-roles/deployer-copy", map[string]interface{}{
+		"robot_name": "deployer",
+	}, "already managed by static role 'deployer'")
+}
+
+func TestApplyToExisting(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+	server.AddRepository(testOrganization, "web")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories": `{"api": "write"}`,
+		"teams":        `{"developers": "member"}`,
+	})
+
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+	username := resp.Data["username"].(string)
+
+	// Without apply_to_existing, role changes only apply to robot accounts issued afterwards
+	if resp := handleRequest(t, b, s, logical.UpdateOperation, "roles/test", withTestNamespace(map[string]interface{}{
+		"repositories": `{"api": "read"}`,
+	})); resp != nil && resp.IsError() {
+		t.Fatalf("error updating role: %v", resp.Error())
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, username, map[string]qc.QuayPermission{"api": qc.QuayPermissionWrite})
+
+	if resp := handleRequest(t, b, s, logical.UpdateOperation, "roles/test", withTestNamespace(map[string]interface{}{
+		"apply_to_existing": true,
+		"repositories":      `{"web": "read"}`,
+		"teams":             `{"operators": "member"}`,
+	})); resp != nil && (resp.IsError() || len(resp.Warnings) != 0) {
+		t.Fatalf("unexpected response updating role: %v", resp)
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, username, map[string]qc.QuayPermission{
+		"api": "",
+		"web": qc.QuayPermissionRead,
+	})
+
+	if members, _ := server.TeamMembers(testOrganization, "operators"); len(members) != 1 || members[0] != username {
+		t.Fatalf("expected '%s' to be a member of team 'operators', got %v", username, members)
+	}
+
+	// The team created for the role is deleted once it has no members
+	if _, ok := server.TeamMembers(testOrganization, "developers"); ok {
+		t.Fatal("expected team 'developers' to be deleted")
+	}
+
+	// Robot accounts deleted outside of Vault are not recreated
+	server.InjectFailure(quaytest.Failure{Method: http.MethodGet, Path: "/api/v1/organization/example/robots/" + robotName, StatusCode: http.StatusNotFound})
+
+	if resp := handleRequest(t, b, s, logical.UpdateOperation, "roles/test", withTestNamespace(map[string]interface{}{
+		"repositories": `{"api": "read"}`,
+	})); resp != nil && (resp.IsError() || len(resp.Warnings) != 0) {
+		t.Fatalf("unexpected response updating role: %v", resp)
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, username, map[string]qc.QuayPermission{"api": ""})
+}
+
+func TestApplyToExistingOtherNamespace(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+	readCredentials(t, b, s, "test", testOrganization)
+
+	// Robot accounts cannot be moved to the new namespace of the role
+	resp := handleRequest(t, b, s, logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"apply_to_existing": true,
+		"namespace_type":    string(NamespaceTypeUser),
+		"namespace_name":    testUsername,
+	})
+	if resp == nil || resp.IsError() || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "was not updated") {
+		t.Fatalf("expected a warning that the robot account was not updated, got %v", resp)
+	}
+}
@@ -2,6 +2,8 @@ package quay
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
@@ -35,6 +37,11 @@ func (b *quayBackend) pathRotateRole(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("name is required"), nil
 	}
 
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// The role is read under the lock so that the rotation does not overwrite a concurrent update of the role
 	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, req.Storage)
 	if err != nil {
 		return nil, err
@@ -44,21 +51,22 @@ func (b *quayBackend) pathRotateRole(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("No Static Role Found"), nil
 	}
 
-	lock := locksutil.LockForKey(b.roleLocks, roleName)
-	lock.Lock()
-	defer lock.Unlock()
-
-	client, err := b.getClient(ctx, req.Storage)
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
 	if err != nil {
 		return nil, err
 	}
 
-	robotAccount, err := b.regenerateRobotPassword(client, roleName, role)
+	robotAccount, err := b.regenerateRobotPassword(ctx, client, role.staticRobotName(roleName), role)
 
 	if err != nil {
 		return nil, err
 	}
 
+	role.LastRotated = time.Now()
+	if err := b.saveRole(ctx, req.Storage, role, staticRolesStoragePath, roleName); err != nil {
+		return nil, err
+	}
+
 	return &logical.Response{
 		Data: map[string]interface{}{
 			"namespace_type":  role.NamespaceType,
@@ -70,5 +78,56 @@ func (b *quayBackend) pathRotateRole(ctx context.Context, req *logical.Request,
 
 }
 
+// rotateStaticRoles regenerates the password of every static role whose rotation period has elapsed
+func (b *quayBackend) rotateStaticRoles(ctx context.Context, s logical.Storage) error {
+	roleNames, err := s.List(ctx, fmt.Sprintf("%s/", staticRolesStoragePath))
+	if err != nil {
+		return err
+	}
+
+	for _, roleName := range roleNames {
+		if err := b.rotateStaticRoleIfDue(ctx, s, roleName); err != nil {
+			b.Logger().Error("error rotating static role", "role", roleName, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *quayBackend) rotateStaticRoleIfDue(ctx context.Context, s logical.Storage, roleName string) error {
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, s)
+	if err != nil {
+		return err
+	}
+
+	// Robot accounts for static roles are created when the credentials are first read
+	if role == nil || role.RotationPeriod == 0 || role.LastRotated.IsZero() {
+		return nil
+	}
+
+	if time.Now().Before(role.LastRotated.Add(role.RotationPeriod)) {
+		return nil
+	}
+
+	client, err := b.getClient(ctx, s, role.Connection)
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.regenerateRobotPassword(ctx, client, role.staticRobotName(roleName), role); err != nil {
+		return err
+	}
+
+	b.Logger().Debug("rotated static role", "role", roleName)
+
+	role.LastRotated = time.Now()
+
+	return b.saveRole(ctx, s, role, staticRolesStoragePath, roleName)
+}
+
 const pathRotateRoleHelpSynopsis = `Rotates the credential for a static role mapped to a Quay Robot Account.`
 const pathRotateRoleHelpDescription = "This path allows you to regenerate the credentials used by a static role mapped to a Quay Robot Account"
@@ -0,0 +1,146 @@
+package quay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// backdateRotation records the last rotation of a static role as having happened two hours ago
+func backdateRotation(t *testing.T, b *quayBackend, s logical.Storage, roleName string) {
+	t.Helper()
+
+	role, err := b.getRole(context.Background(), staticRolesStoragePath, roleName, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role.LastRotated = time.Now().Add(-2 * time.Hour)
+	if err := b.saveRole(context.Background(), s, role, staticRolesStoragePath, roleName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaticRoleRotationPeriod(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "static-roles/test", map[string]interface{}{
+		"rotation_period": "1h",
+	})
+
+	resp := readStaticCredentials(t, b, s, "test")
+	password := resp.Data["password"]
+
+	if resp.Data["rotation_period"] != float64(3600) {
+		t.Fatalf("expected rotation_period 3600, got %v", resp.Data["rotation_period"])
+	}
+
+	if ttl := resp.Data["ttl"].(int64); ttl <= 0 || ttl > 3600 {
+		t.Fatalf("expected ttl until the next rotation, got %d", ttl)
+	}
+
+	// The rotation period has not elapsed
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+
+	if robot, _ := server.Robot(testOrganization, "test"); robot.Token != password {
+		t.Fatal("expected the password not to be rotated before the rotation period elapses")
+	}
+
+	backdateRotation(t, b, s, "test")
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+
+	robot, _ := server.Robot(testOrganization, "test")
+	if robot.Token == password {
+		t.Fatal("expected the password to be rotated once the rotation period elapsed")
+	}
+
+	if resp := readStaticCredentials(t, b, s, "test"); resp.Data["password"] != robot.Token {
+		t.Fatal("expected the rotated password to be returned")
+	}
+}
+
+func TestStaticRoleRotationSkippedOnPerformanceStandby(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "static-roles/test", map[string]interface{}{
+		"rotation_period": "1h",
+	})
+
+	password := readStaticCredentials(t, b, s, "test").Data["password"]
+
+	backdateRotation(t, b, s, "test")
+
+	b.System().(*logical.StaticSystemView).ReplicationStateVal = consts.ReplicationPerformanceStandby
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+
+	if robot, _ := server.Robot(testOrganization, "test"); robot.Token != password {
+		t.Fatal("expected the password not to be rotated by a performance standby")
+	}
+}
+
+func TestRotateRoleKeepsConcurrentRoleUpdate(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	writeRole(t, b, s, "static-roles/test", nil)
+	readStaticCredentials(t, b, s, "test")
+
+	// A role update is in progress while the rotation is requested
+	lock := locksutil.LockForKey(b.roleLocks, "test")
+	lock.Lock()
+
+	rotated := make(chan *logical.Response, 1)
+	go func() {
+		resp, _ := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "rotate-role/test",
+			Storage:   s,
+		})
+		rotated <- resp
+	}()
+
+	select {
+	case resp := <-rotated:
+		lock.Unlock()
+		t.Fatalf("expected rotating to wait for the role lock, got %v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	role, err := b.getRole(context.Background(), staticRolesStoragePath, "test", s)
+	if err != nil {
+		lock.Unlock()
+		t.Fatal(err)
+	}
+
+	role.RotationPeriod = 2 * time.Hour
+	if err := b.saveRole(context.Background(), s, role, staticRolesStoragePath, "test"); err != nil {
+		lock.Unlock()
+		t.Fatal(err)
+	}
+
+	lock.Unlock()
+
+	if resp := <-rotated; resp == nil || resp.IsError() {
+		t.Fatalf("error rotating role: %v", resp)
+	}
+
+	role, err = b.getRole(context.Background(), staticRolesStoragePath, "test", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role.RotationPeriod != 2*time.Hour {
+		t.Fatalf("expected the role update to be kept, got rotation_period %s", role.RotationPeriod)
+	}
+}
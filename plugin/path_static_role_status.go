@@ -0,0 +1,135 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathStaticRoleStatus(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("%s/%s/status", staticRolesStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the role",
+					Required:    true,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.pathStaticRoleStatus,
+			},
+
+			HelpSynopsis:    pathStaticRoleStatusHelpSynopsis,
+			HelpDescription: pathStaticRoleStatusHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s/reconcile", staticRolesStoragePath, framework.GenericNameRegex("name")),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeLowerCaseString,
+					Description: "Name of the role",
+					Required:    true,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathStaticRoleReconcile,
+			},
+
+			HelpSynopsis:    pathStaticRoleReconcileHelpSynopsis,
+			HelpDescription: pathStaticRoleReconcileHelpDescription,
+		},
+	}
+}
+
+func (b *quayBackend) pathStaticRoleStatus(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+
+	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return logical.ErrorResponse("No Static Role Found"), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	robotAccount, _, apiError := client.GetRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, role.staticRobotName(roleName))
+	if isRobotNotFound(apiError.Error) {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"exists":  false,
+				"in_sync": false,
+			},
+		}, nil
+	} else if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	drift, err := b.getRobotDrift(ctx, client, &robotAccount, role.staticRobotName(roleName), role)
+	if err != nil {
+		return nil, err
+	}
+
+	respData := drift.responseData()
+	respData["exists"] = true
+	respData["username"] = robotAccount.Name
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *quayBackend) pathStaticRoleReconcile(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+
+	role, err := b.getRole(ctx, staticRolesStoragePath, roleName, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return logical.ErrorResponse("No Static Role Found"), nil
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	client, err := b.getClient(ctx, req.Storage, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	robotAccountRequest, err := role.robotAccountRequest(roleName, req)
+	if err != nil {
+		return nil, err
+	}
+
+	drift, err := b.reconcileRobot(ctx, client, role.staticRobotName(roleName), role, robotAccountRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: drift.responseData(),
+	}, nil
+}
+
+const pathStaticRoleStatusHelpSynopsis = `Compare the robot account of a static role against the role.`
+const pathStaticRoleStatusHelpDescription = "This path reports the teams, prototypes and repository permissions of the robot account that differ from those defined by the static role."
+const pathStaticRoleReconcileHelpSynopsis = `Bring the robot account of a static role in line with the role.`
+const pathStaticRoleReconcileHelpDescription = "This path grants the teams, prototypes and repository permissions defined by the static role and removes those the role no longer grants. The differences found before reconciling are returned."
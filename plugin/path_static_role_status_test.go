@@ -0,0 +1,102 @@
+package quay
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+func TestStaticRoleStatusAndReconcile(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+	server.AddRepository(testOrganization, "web")
+	server.AddTeam(testOrganization, "ops", qc.QuayTeamRoleMember, "")
+
+	writeRole(t, b, s, "static-roles/test", map[string]interface{}{
+		"robot_name":   "deployer",
+		"teams":        `{"developers": "member"}`,
+		"repositories": `{"api": "write"}`,
+	})
+
+	username := testOrganization + "+deployer"
+
+	// The robot account is created when the credentials are first read
+	resp := handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/status", nil)
+	if resp.Data["exists"] != false {
+		t.Fatalf("expected the robot account not to exist, got %v", resp.Data)
+	}
+
+	readStaticCredentials(t, b, s, "test")
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/status", nil)
+	if resp.Data["exists"] != true || resp.Data["in_sync"] != true || resp.Data["username"] != username {
+		t.Fatalf("expected the robot account to be in sync, got %v", resp.Data)
+	}
+
+	// Change the robot account outside of Vault
+	server.RemoveTeamMember(testOrganization, "developers", username)
+	server.AddTeamMember(testOrganization, "ops", username)
+	server.SetRepositoryPermission(testOrganization, "api", username, qc.QuayPermissionRead)
+	server.SetRepositoryPermission(testOrganization, "web", username, qc.QuayPermissionAdmin)
+
+	expected := map[string]interface{}{
+		"in_sync": false,
+		"teams": map[string]interface{}{
+			"missing":    []string{"developers"},
+			"unexpected": []string{"ops"},
+		},
+		"repositories": map[string]interface{}{
+			"missing": map[string]Permission{},
+			"incorrect": map[string]repositoryPermissionDrift{
+				"api": {Expected: PermissionWrite, Actual: PermissionRead},
+			},
+			"unexpected": map[string]Permission{"web": PermissionAdmin},
+		},
+	}
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/status", nil)
+	for key, value := range expected {
+		if !reflect.DeepEqual(resp.Data[key], value) {
+			t.Fatalf("expected %s %v, got %v", key, value, resp.Data[key])
+		}
+	}
+
+	// Reconcile reports the drift it corrected
+	resp = handleRequest(t, b, s, logical.UpdateOperation, "static-roles/test/reconcile", nil)
+	if resp.Data["in_sync"] != false {
+		t.Fatalf("expected reconcile to report the drift it corrected, got %v", resp.Data)
+	}
+
+	requireTeamMembers(t, server, "developers", username)
+	requireTeamMembers(t, server, "ops")
+	requireRepositoryPermissions(t, server, testOrganization, username, map[string]qc.QuayPermission{
+		"api": qc.QuayPermissionWrite,
+		"web": "",
+	})
+
+	resp = handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/status", nil)
+	if resp.Data["in_sync"] != true {
+		t.Fatalf("expected the robot account to be in sync after reconcile, got %v", resp.Data)
+	}
+}
+
+func TestStaticRoleStatusRobotDeleted(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "static-roles/test", map[string]interface{}{
+		"robot_name": "deployer",
+	})
+	readStaticCredentials(t, b, s, "test")
+
+	server.InjectFailure(quaytest.Failure{Method: http.MethodGet, Path: "/api/v1/organization/example/robots/deployer", StatusCode: http.StatusNotFound})
+
+	resp := handleRequest(t, b, s, logical.ReadOperation, "static-roles/test/status", nil)
+	if resp.Data["exists"] != false || resp.Data["in_sync"] != false {
+		t.Fatalf("expected a missing robot account to be reported, got %v", resp.Data)
+	}
+}
@@ -0,0 +1,470 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	autoTidyPath            = "auto-tidy"
+	autoTidyStoragePath     = "auto-tidy"
+	defaultAutoTidyInterval = 12 * time.Hour
+
+	// robotTrackingStartStoragePath records when the mount started tracking the robot accounts it issues
+	robotTrackingStartStoragePath = "robot-tracking-start"
+)
+
+type robotTrackingStart struct {
+	Time time.Time `json:"time"`
+}
+
+type autoTidyConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval"`
+}
+
+func pathTidy(b *quayBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "tidy/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"dry_run": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Report the robot accounts that would be deleted without deleting them",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathTidy,
+			},
+
+			HelpSynopsis:    pathTidyHelpSynopsis,
+			HelpDescription: pathTidyHelpDescription,
+		},
+		{
+			Pattern: fmt.Sprintf("%s/%s", configStoragePath, autoTidyPath),
+			Fields: map[string]*framework.FieldSchema{
+				"enabled": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Enable the automatic tidy of orphaned robot accounts",
+				},
+				"interval": {
+					Type:        framework.TypeDurationSecond,
+					Default:     int(defaultAutoTidyInterval.Seconds()),
+					Description: "Interval between automatic tidy operations",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathAutoTidyConfigRead,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAutoTidyConfigWrite,
+				},
+			},
+
+			HelpSynopsis:    pathAutoTidyConfigHelpSynopsis,
+			HelpDescription: pathAutoTidyConfigHelpDescription,
+		},
+	}
+}
+
+func (b *quayBackend) pathTidy(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	dryRun := data.Get("dry_run").(bool)
+
+	if !atomic.CompareAndSwapUint32(&b.tidyRunning, 0, 1) {
+		return logical.ErrorResponse("a tidy operation is already running"), nil
+	}
+	defer atomic.StoreUint32(&b.tidyRunning, 0)
+
+	robots, err := b.tidyRobots(ctx, req.Storage, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"dry_run": dryRun,
+			"robots":  robots,
+		},
+	}, nil
+}
+
+func (b *quayBackend) pathAutoTidyConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":  config.Enabled,
+			"interval": config.Interval.Seconds(),
+		},
+	}, nil
+}
+
+func (b *quayBackend) pathAutoTidyConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabled.(bool)
+	}
+
+	if interval, ok := data.GetOk("interval"); ok {
+		config.Interval = time.Duration(interval.(int)) * time.Second
+	}
+
+	if config.Interval <= 0 {
+		return logical.ErrorResponse("interval must be greater than 0"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(autoTidyStoragePath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, req.Storage.Put(ctx, entry)
+}
+
+func getAutoTidyConfig(ctx context.Context, s logical.Storage) (*autoTidyConfig, error) {
+	config := &autoTidyConfig{
+		Interval: defaultAutoTidyInterval,
+	}
+
+	entry, err := s.Get(ctx, autoTidyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("error reading auto tidy configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// autoTidy runs the tidy operation when automatic tidy is enabled and the interval has elapsed
+func (b *quayBackend) autoTidy(ctx context.Context, s logical.Storage) error {
+	config, err := getAutoTidyConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if !config.Enabled {
+		return nil
+	}
+
+	b.Lock()
+	due := time.Now().After(b.lastAutoTidy.Add(config.Interval))
+	b.Unlock()
+
+	if !due || !atomic.CompareAndSwapUint32(&b.tidyRunning, 0, 1) {
+		return nil
+	}
+	defer atomic.StoreUint32(&b.tidyRunning, 0)
+
+	b.Lock()
+	b.lastAutoTidy = time.Now()
+	b.Unlock()
+
+	_, err = b.tidyRobots(ctx, s, false)
+
+	return err
+}
+
+// tidyRobots deletes robot accounts that were created for dynamic roles but no longer have an outstanding lease
+func (b *quayBackend) tidyRobots(ctx context.Context, s logical.Storage, dryRun bool) ([]string, error) {
+	roleNames, err := s.List(ctx, fmt.Sprintf("%s/", rolesStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	excludedRobots, err := b.staticRobotNames(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	libraryRobots, err := b.libraryRobotNames(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for robotKey := range libraryRobots {
+		excludedRobots[robotKey] = true
+	}
+
+	// Robot accounts that are being provisioned are removed by rollback if provisioning fails
+	provisioningRobots, err := walRobotNames(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for robotKey := range provisioningRobots {
+		excludedRobots[robotKey] = true
+	}
+
+	// Username templates may generate names that match the pattern of another role in the same namespace
+	leasedRobots, err := b.leasedRobotNames(ctx, s, roleNames)
+	if err != nil {
+		return nil, err
+	}
+
+	for robotKey := range leasedRobots {
+		excludedRobots[robotKey] = true
+	}
+
+	trackingStart, err := getRobotTrackingStart(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceRobots := map[string][]qc.RobotAccount{}
+	tidiedRobots := []string{}
+
+	for _, roleName := range roleNames {
+		robots, err := b.tidyRoleRobots(ctx, s, roleName, excludedRobots, namespaceRobots, trackingStart, dryRun)
+		if err != nil {
+			return tidiedRobots, fmt.Errorf("error tidying robot accounts for role '%s': %w", roleName, err)
+		}
+
+		tidiedRobots = append(tidiedRobots, robots...)
+	}
+
+	return tidiedRobots, nil
+}
+
+func (b *quayBackend) tidyRoleRobots(ctx context.Context, s logical.Storage, roleName string, excludedRobots map[string]bool, namespaceRobots map[string][]qc.RobotAccount, trackingStart time.Time, dryRun bool) ([]string, error) {
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := b.getRole(ctx, rolesStoragePath, roleName, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, nil
+	}
+
+	client, err := b.getClient(ctx, s, role.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	roleNamespaceKey := namespaceKey(role.Connection, role.NamespaceType, role.NamespaceName)
+
+	// Robot accounts are listed once per namespace as roles may share a namespace
+	robots, ok := namespaceRobots[roleNamespaceKey]
+	if !ok {
+		var apiError qc.QuayApiError
+		robots, _, apiError = client.ListRobotAccounts(ctx, role.NamespaceType.String(), role.NamespaceName, nil)
+		if apiError.Error != nil {
+			return nil, apiError.Error
+		}
+		namespaceRobots[roleNamespaceKey] = robots
+	}
+
+	trackedRobots, err := b.listDynamicRobots(ctx, s, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Robot accounts waiting in the pool of the role are not orphaned
+	pooledRobots, err := b.listPooledRobots(ctx, s, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(trackedRobots)+len(pooledRobots))
+	for _, trackedRobot := range append(trackedRobots, pooledRobots...) {
+		tracked[trackedRobot] = true
+	}
+
+	tidiedRobots := []string{}
+
+	robotNamePattern, err := role.generatedRobotNameRegex(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, robot := range robots {
+		robotName := robotShortName(robot.Name)
+
+		if !robotNamePattern.MatchString(robotName) || tracked[robotName] || excludedRobots[fmt.Sprintf("%s/%s", roleNamespaceKey, robotName)] {
+			continue
+		}
+
+		// Robot accounts created before tracking started may have outstanding leases that were never tracked.
+		// Quay reports creation dates to the second, so robot accounts created within that second are considered tracked
+		if parseQuayTime(robot.Created).Before(trackingStart.Truncate(time.Second)) {
+			continue
+		}
+
+		if !dryRun {
+			if err := b.deleteRobot(ctx, client, robotName, role); err != nil {
+				return tidiedRobots, err
+			}
+
+			b.Logger().Info("deleted orphaned robot account", "role", roleName, "robot", robot.Name)
+		}
+
+		tidiedRobots = append(tidiedRobots, robot.Name)
+	}
+
+	if !dryRun && len(tidiedRobots) > 0 && role.NamespaceType == NamespaceTypeOrganization {
+		if err := b.deleteUnusedTeams(ctx, client, role.NamespaceName, b.assembleTeamNames(role)); err != nil {
+			return tidiedRobots, err
+		}
+	}
+
+	return tidiedRobots, nil
+}
+
+// getRobotTrackingStart returns when the mount started tracking the robot accounts it issues, recording the
+// current time if it has not been recorded
+func getRobotTrackingStart(ctx context.Context, s logical.Storage) (time.Time, error) {
+	entry, err := s.Get(ctx, robotTrackingStartStoragePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if entry != nil {
+		trackingStart := &robotTrackingStart{}
+		if err := entry.DecodeJSON(trackingStart); err != nil {
+			return time.Time{}, fmt.Errorf("error reading robot tracking start: %w", err)
+		}
+
+		return trackingStart.Time, nil
+	}
+
+	trackingStart := &robotTrackingStart{Time: time.Now().UTC()}
+
+	entry, err = logical.StorageEntryJSON(robotTrackingStartStoragePath, trackingStart)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return trackingStart.Time, s.Put(ctx, entry)
+}
+
+// leasedRobotNames returns the robot accounts that are leased or pooled for dynamic roles keyed by namespace and robot name
+func (b *quayBackend) leasedRobotNames(ctx context.Context, s logical.Storage, roleNames []string) (map[string]bool, error) {
+	leasedRobots := map[string]bool{}
+
+	for _, roleName := range roleNames {
+		role, err := b.getRole(ctx, rolesStoragePath, roleName, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if role == nil {
+			continue
+		}
+
+		trackedRobots, err := b.listDynamicRobots(ctx, s, roleName)
+		if err != nil {
+			return nil, err
+		}
+
+		pooledRobots, err := b.listPooledRobots(ctx, s, roleName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, robotName := range append(trackedRobots, pooledRobots...) {
+			leasedRobots[fmt.Sprintf("%s/%s", namespaceKey(role.Connection, role.NamespaceType, role.NamespaceName), robotName)] = true
+		}
+	}
+
+	return leasedRobots, nil
+}
+
+// staticRobotNames returns the robot accounts managed by static roles keyed by namespace and robot name
+func (b *quayBackend) staticRobotNames(ctx context.Context, s logical.Storage) (map[string]bool, error) {
+	roleNames, err := s.List(ctx, fmt.Sprintf("%s/", staticRolesStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	staticRobots := make(map[string]bool, len(roleNames))
+
+	for _, roleName := range roleNames {
+		role, err := b.getRole(ctx, staticRolesStoragePath, roleName, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if role == nil {
+			continue
+		}
+
+		staticRobots[fmt.Sprintf("%s/%s", namespaceKey(role.Connection, role.NamespaceType, role.NamespaceName), role.staticRobotName(roleName))] = true
+	}
+
+	return staticRobots, nil
+}
+
+// libraryRobotNames returns the robot accounts managed by library sets keyed by namespace and robot name
+func (b *quayBackend) libraryRobotNames(ctx context.Context, s logical.Storage) (map[string]bool, error) {
+	setNames, err := s.List(ctx, fmt.Sprintf("%s/", libraryStoragePath))
+	if err != nil {
+		return nil, err
+	}
+
+	libraryRobots := map[string]bool{}
+
+	for _, setName := range setNames {
+		set, err := b.getLibrarySet(ctx, s, setName)
+		if err != nil {
+			return nil, err
+		}
+
+		if set == nil {
+			continue
+		}
+
+		for _, robotName := range set.RobotNames {
+			libraryRobots[fmt.Sprintf("%s/%s", namespaceKey(set.Connection, set.NamespaceType, set.NamespaceName), robotName)] = true
+		}
+	}
+
+	return libraryRobots, nil
+}
+
+func namespaceKey(connection string, namespaceType NamespaceType, namespaceName string) string {
+	return fmt.Sprintf("%s/%s/%s", connection, namespaceType, namespaceName)
+}
+
+const pathTidyHelpSynopsis = `Delete orphaned robot accounts created for dynamic roles.`
+
+const pathTidyHelpDescription = `
+This path deletes robot accounts in the namespace of each dynamic role that
+match the naming pattern of the role but do not have an outstanding lease
+recorded by Vault. Robot accounts created before the mount started recording
+leases are never deleted. Set dry_run to report the robot accounts that would
+be deleted without deleting them.
+`
+
+const pathAutoTidyConfigHelpSynopsis = `Configure the automatic tidy of orphaned robot accounts.`
+
+const pathAutoTidyConfigHelpDescription = `
+When enabled, the tidy operation is run periodically once the configured
+interval has elapsed since the previous automatic tidy.
+`
@@ -0,0 +1,99 @@
+package quay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// tidy runs the tidy endpoint and returns the full names of the robot accounts it reported
+func tidy(t *testing.T, b *quayBackend, s logical.Storage, dryRun bool) []string {
+	t.Helper()
+
+	resp := handleRequest(t, b, s, logical.UpdateOperation, "tidy", map[string]interface{}{
+		"dry_run": dryRun,
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("error tidying: %v", resp)
+	}
+
+	return resp.Data["robots"].([]string)
+}
+
+func TestTidy(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	_, leasedRobotName := readCredentials(t, b, s, "test", testOrganization)
+
+	server.AddRobot(testOrganization, "test-orphn")
+	server.AddRobot(testOrganization, "unrelated")
+
+	for _, dryRun := range []bool{true, false} {
+		if robots := tidy(t, b, s, dryRun); len(robots) != 1 || robots[0] != testOrganization+"+test-orphn" {
+			t.Fatalf("expected only 'test-orphn' to be tidied, got %v", robots)
+		}
+
+		requireRobot(t, server, testOrganization, "test-orphn", dryRun)
+	}
+
+	requireRobot(t, server, testOrganization, leasedRobotName, true)
+	requireRobot(t, server, testOrganization, "unrelated", true)
+}
+
+func TestTidySkipsRobotsCreatedBeforeTracking(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	// A robot account leased before the mount started tracking leases
+	server.AddRobot(testOrganization, "test-upgrd")
+	server.SetRobotCreated(testOrganization, "test-upgrd", time.Now().Add(-time.Hour))
+
+	server.AddRobot(testOrganization, "test-orphn")
+
+	if robots := tidy(t, b, s, false); len(robots) != 1 || robots[0] != testOrganization+"+test-orphn" {
+		t.Fatalf("expected only 'test-orphn' to be tidied, got %v", robots)
+	}
+
+	requireRobot(t, server, testOrganization, "test-upgrd", true)
+
+	// The tracking start is recorded once and kept across restarts
+	trackingStart, err := getRobotTrackingStart(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Initialize(context.Background(), &logical.InitializationRequest{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+
+	if restarted, err := getRobotTrackingStart(context.Background(), s); err != nil || !restarted.Equal(trackingStart) {
+		t.Fatalf("expected tracking start %s to be kept, got %s", trackingStart, restarted)
+	}
+}
+
+func TestTidySkipsLibraryRobots(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/ci", nil)
+
+	// A robot account of a library set whose name matches the pattern of the role
+	server.AddRobot(testOrganization, "ci-build")
+
+	writeConfig(t, b, s, "library/builders", map[string]interface{}{
+		"namespace_name": testOrganization,
+		"robot_names":    "ci-build",
+	})
+
+	server.AddRobot(testOrganization, "ci-orphn")
+
+	if robots := tidy(t, b, s, false); len(robots) != 1 || robots[0] != testOrganization+"+ci-orphn" {
+		t.Fatalf("expected only 'ci-orphn' to be tidied, got %v", robots)
+	}
+
+	requireRobot(t, server, testOrganization, "ci-build", true)
+}
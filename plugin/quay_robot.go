@@ -1,8 +1,11 @@
 package quay
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
 )
 
@@ -12,46 +15,64 @@ var (
 
 const (
 	Vault string = "vault"
+
+	// vaultTeamDescription marks the teams created by Vault so that they can be deleted once they are no longer used
+	vaultTeamDescription = "Managed by Vault"
 )
 
-func (b *quayBackend) createRobot(client *client, robotName string, role *quayRoleEntry) (*qc.RobotAccount, error) {
+// createRobot creates a robot account unless it already exists and grants it the access of its role
+func (b *quayBackend) createRobot(ctx context.Context, client *client, robotName string, role *quayRoleEntry, robotAccountRequest *qc.RobotAccountRequest) (*qc.RobotAccount, error) {
 	// Check if Account Exists
-	robotAccount, existingRobotAccountResponse, apiError := client.GetRobotAccount(role.NamespaceType.String(), role.NamespaceName, robotName)
+	robotAccount, _, apiError := client.GetRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
 
-	if apiError.Error != nil {
-		return nil, apiError.Error
-		// A 400 response will be returned with a robot not found. If not, create it
-	} else if existingRobotAccountResponse.StatusCode == 400 {
+	if isRobotNotFound(apiError.Error) {
+
+		// Adopted robot accounts are managed but never created
+		if role.Adopt {
+			return nil, fmt.Errorf("robot account '%s' does not exist in namespace '%s' and the role only adopts existing robot accounts", robotName, role.NamespaceName)
+		}
 
 		// Create new Account
-		robotAccount, _, apiError = client.CreateRobotAccount(role.NamespaceType.String(), role.NamespaceName, robotName)
+		robotAccount, _, apiError = client.CreateRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName, robotAccountRequest)
 		if apiError.Error != nil {
 			return nil, apiError.Error
 		}
+	} else if apiError.Error != nil {
+		return nil, apiError.Error
 	}
 
+	if err := b.grantRobot(ctx, client, &robotAccount, robotName, role); err != nil {
+		return nil, err
+	}
+
+	return &robotAccount, nil
+}
+
+// grantRobot adds a robot account to the teams of its role and grants the default permission and
+// repository permissions of the role that the robot account does not have yet
+func (b *quayBackend) grantRobot(ctx context.Context, client *client, robotAccount *qc.RobotAccount, robotName string, role *quayRoleEntry) error {
 	if role.NamespaceType == organization {
 		// Create Teams
-		err := b.createAssignTeam(client, robotAccount.Name, role)
+		err := b.createAssignTeam(ctx, client, robotAccount.Name, role)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// Create Default Permission
 		if role.DefaultPermission != nil {
-			organizationPrototypes, organizationPrototypesResponse, organizationPrototypesError := client.GetPrototypesByOrganization(role.NamespaceName)
+			organizationPrototypes, _, organizationPrototypesError := client.GetPrototypesByOrganization(ctx, role.NamespaceName)
 
-			if organizationPrototypesError.Error != nil || organizationPrototypesResponse.StatusCode != 200 {
-				return nil, organizationPrototypesError.Error
+			if organizationPrototypesError.Error != nil {
+				return organizationPrototypesError.Error
 			}
 
 			if found := isRobotAccountInPrototypeByRole(organizationPrototypes.Prototypes, robotAccount.Name, role.DefaultPermission.String()); !found {
 
-				_, robotPrototypeResponse, robotPrototypeError := client.CreateRobotPermissionForOrganization(role.NamespaceName, robotAccount.Name, role.DefaultPermission.String())
+				_, _, robotPrototypeError := client.CreateRobotPermissionForOrganization(ctx, role.NamespaceName, robotAccount.Name, role.DefaultPermission.String())
 
-				if robotPrototypeError.Error != nil || robotPrototypeResponse.StatusCode != 200 {
-					return nil, robotPrototypeError.Error
+				if robotPrototypeError.Error != nil {
+					return robotPrototypeError.Error
 				}
 
 			}
@@ -62,45 +83,38 @@ func (b *quayBackend) createRobot(client *client, robotName string, role *quayRo
 	// Manage Repositories
 	if role.Repositories != nil || role.DefaultPermission != nil {
 		// Get Robot Permissions
-		robotPermissions, robotPermissionsResponse, robotPermissionsError := client.GetRobotPermissions(role.NamespaceName, robotName)
+		robotPermissions, _, robotPermissionsError := client.GetRobotPermissions(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
 
-		if robotPermissionsError.Error != nil || robotPermissionsResponse.StatusCode != 200 {
-			return nil, robotPermissionsError.Error
+		if robotPermissionsError.Error != nil {
+			return robotPermissionsError.Error
 		}
 
 		// Get Repositories
-		namespaceRepositories, namespaceRepositoriesResponse, namespaceRepositoriesError := client.GetRepositoriesForNamespace(role.NamespaceName)
+		namespaceRepositories, _, namespaceRepositoriesError := client.GetRepositoriesForNamespace(ctx, role.NamespaceName)
 
-		if namespaceRepositoriesError.Error != nil || namespaceRepositoriesResponse.StatusCode != 200 {
-			return nil, robotPermissionsError.Error
+		if namespaceRepositoriesError.Error != nil {
+			return namespaceRepositoriesError.Error
+		}
+
+		if role.CreateMissingRepositories {
+			var err error
+			if namespaceRepositories, err = b.createMissingRepositories(ctx, client, role, namespaceRepositories); err != nil {
+				return err
+			}
 		}
 
 		// Loop through Quay repositories
 		for _, namespaceRepository := range namespaceRepositories {
 
-			var desiredPermission *Permission
-
-			// Check if a Default Permission should be applied
-			if role.DefaultPermission != nil {
-				desiredPermission = role.DefaultPermission
-			}
-
-			// Check if explicit permission desired
-			if role.Repositories != nil {
-				// Deference repositories
-				roleRepositories := *role.Repositories
-				if rolePermission, ok := roleRepositories[namespaceRepository.Name]; ok {
-					desiredPermission = &rolePermission
-				}
-			}
+			desiredPermission := role.repositoryPermission(namespaceRepository.Name)
 
 			if desiredPermission != nil {
 				// Check to see if permission already exists on robot account
 				if updatePermissions := shouldNeedUpdateRepositoryPermissions(namespaceRepository.Name, desiredPermission.String(), &robotPermissions.Permissions); updatePermissions {
-					_, repositoryPermissionUpdateResponse, repositoryPermissionError := client.UpdateRepositoryUserPermission(role.NamespaceName, namespaceRepository.Name, robotName, desiredPermission.String())
+					_, _, repositoryPermissionError := client.UpdateRepositoryUserPermission(ctx, role.NamespaceName, namespaceRepository.Name, robotAccountName(role.NamespaceName, robotName), desiredPermission.String())
 
-					if repositoryPermissionError.Error != nil || repositoryPermissionUpdateResponse.StatusCode != 200 {
-						return nil, repositoryPermissionError.Error
+					if repositoryPermissionError.Error != nil {
+						return repositoryPermissionError.Error
 					}
 				}
 
@@ -108,55 +122,65 @@ func (b *quayBackend) createRobot(client *client, robotName string, role *quayRo
 
 		}
 
-		/*
-			for repositoryName, permission := range *role.Repositories {
-
-				// Verify repository exists in the organization
-				if updateRepository := repositoryExists(repositoryName, &namespaceRepositories); updateRepository {
-					// Check to see if permission already exists on robot account
-					if updatePermissions := shouldNeedUpdateRepositoryPermissions(repositoryName, permission.String(), &robotPermissions.Permissions); updatePermissions {
-						_, repositoryPermissionUpdateResponse, repositoryPermissionError := client.UpdateRepositoryUserPermission(role.NamespaceName, repositoryName, robotName, permission.String())
-
-						if repositoryPermissionError.Error != nil || repositoryPermissionUpdateResponse.StatusCode != 200 {
-							return nil, repositoryPermissionError.Error
-						}
-					}
-				}
-			}
-		*/
 	}
 
-	return &robotAccount, nil
+	return nil
 }
 
-func (b *quayBackend) deleteRobot(client *client, robotName string, role *quayRoleEntry) error {
+func (b *quayBackend) deleteRobot(ctx context.Context, client *client, robotName string, role *quayRoleEntry) error {
 
-	_, apiError := client.DeleteRobotAccount(role.NamespaceType.String(), role.NamespaceName, robotName)
+	_, apiError := client.DeleteRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
+
+	// Robot account has already been removed
+	if isRobotNotFound(apiError.Error) {
+		return nil
+	}
 
 	return apiError.Error
 }
 
-func (b *quayBackend) regenerateRobotPassword(client *client, robotName string, role *quayRoleEntry) (*qc.RobotAccount, error) {
+func (b *quayBackend) regenerateRobotPassword(ctx context.Context, client *client, robotName string, role *quayRoleEntry) (*qc.RobotAccount, error) {
 
-	robotAccount, _, apiError := client.RegenerateRobotAccountPassword(role.NamespaceType.String(), role.NamespaceName, robotName)
+	robotAccount, _, apiError := client.RegenerateRobotAccountPassword(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
 
 	return &robotAccount, apiError.Error
 }
 
-func (b *quayBackend) createAssignTeam(client *client, robotName string, role *quayRoleEntry) error {
+func (b *quayBackend) createAssignTeam(ctx context.Context, client *client, robotName string, role *quayRoleEntry) error {
 
 	teams := b.assembleTeams(role)
 
+	if len(teams) == 0 {
+		return nil
+	}
+
+	// Teams are not deleted while robot accounts are being added to them
+	lock := locksutil.LockForKey(b.teamLocks, role.NamespaceName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	quayOrganization, _, apiError := client.GetOrganization(ctx, role.NamespaceName)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
 	for _, team := range teams {
+		// Mark new teams as created by Vault and preserve the description of existing teams
+		if existingTeam, ok := quayOrganization.Teams[team.Name]; ok {
+			team.Description = existingTeam.Description
+		} else {
+			team.Description = vaultTeamDescription
+		}
+
 		// Create Team
-		_, _, err := client.CreateTeam(role.NamespaceName, team)
+		_, _, err := client.CreateTeam(ctx, role.NamespaceName, team)
 
 		if err.Error != nil {
 			return err.Error
 		}
 
 		// Add member to team
-		_, err = client.AddTeamMember(role.NamespaceName, team.Name, robotName)
+		_, err = client.AddTeamMember(ctx, role.NamespaceName, team.Name, robotName)
 
 		if err.Error != nil {
 			return err.Error
@@ -167,6 +191,81 @@ func (b *quayBackend) createAssignTeam(client *client, robotName string, role *q
 	return nil
 }
 
+// robotAccountName returns the full name of a robot account, which is prefixed by the name of its namespace
+func robotAccountName(namespaceName string, robotName string) string {
+	return fmt.Sprintf("%s+%s", namespaceName, robotName)
+}
+
+// releaseRobot removes a robot account from teams and optionally deletes it. Teams created by Vault that are
+// left without members are deleted
+func (b *quayBackend) releaseRobot(ctx context.Context, client *client, robotName string, namespaceType NamespaceType, namespaceName string, teams []string, delete bool) error {
+
+	if namespaceType == NamespaceTypeOrganization {
+		for _, team := range teams {
+			_, apiError := client.RemoveTeamMember(ctx, namespaceName, team, robotAccountName(namespaceName, robotName))
+			if apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+				return apiError.Error
+			}
+		}
+	}
+
+	if delete {
+		if err := b.deleteRobot(ctx, client, robotName, &quayRoleEntry{
+			NamespaceType: namespaceType,
+			NamespaceName: namespaceName,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if namespaceType == NamespaceTypeOrganization {
+		return b.deleteUnusedTeams(ctx, client, namespaceName, teams)
+	}
+
+	return nil
+}
+
+// deleteUnusedTeams deletes the given teams within an organization if they were created by Vault and no
+// longer have any members. Teams of an organization are not deleted while robot accounts are being added to them
+func (b *quayBackend) deleteUnusedTeams(ctx context.Context, client *client, organizationName string, teamNames []string) error {
+
+	if len(teamNames) == 0 {
+		return nil
+	}
+
+	lock := locksutil.LockForKey(b.teamLocks, organizationName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	quayOrganization, _, apiError := client.GetOrganization(ctx, organizationName)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	for _, teamName := range strutil.RemoveDuplicates(teamNames, false) {
+		if team, ok := quayOrganization.Teams[teamName]; !ok || team.Description != vaultTeamDescription {
+			continue
+		}
+
+		teamMembers, _, apiError := client.GetTeamMembers(ctx, organizationName, teamName)
+		if apiError.Error != nil {
+			return apiError.Error
+		}
+
+		if len(teamMembers.Members) > 0 {
+			continue
+		}
+
+		if _, apiError := client.DeleteTeam(ctx, organizationName, teamName); apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+			return apiError.Error
+		}
+
+		b.Logger().Debug("deleted unused team", "organization", organizationName, "team", teamName)
+	}
+
+	return nil
+}
+
 func (*quayBackend) assembleTeams(role *quayRoleEntry) map[string]*qc.Team {
 	teams := map[string]*qc.Team{}
 
@@ -193,6 +292,45 @@ func (*quayBackend) assembleTeams(role *quayRoleEntry) map[string]*qc.Team {
 	return teams
 }
 
+func (b *quayBackend) assembleTeamNames(role *quayRoleEntry) []string {
+	teamNames := []string{}
+
+	if role.NamespaceType == organization {
+		for teamName := range b.assembleTeams(role) {
+			teamNames = append(teamNames, teamName)
+		}
+	}
+
+	return teamNames
+}
+
+// isRobotNotFound returns whether err indicates that a robot account does not exist.
+// Quay responds with a 400 rather than a 404 when a robot account cannot be found
+func isRobotNotFound(err error) bool {
+	return qc.IsNotFound(err) || qc.IsBadRequest(err)
+}
+
+// repositoryPermission returns the permission the role grants on a repository or nil if no permission is granted
+func (role *quayRoleEntry) repositoryPermission(repositoryName string) *Permission {
+
+	var desiredPermission *Permission
+
+	// Check if a Default Permission should be applied
+	if role.DefaultPermission != nil {
+		desiredPermission = role.DefaultPermission
+	}
+
+	// Check if explicit permission desired
+	if role.Repositories != nil {
+		// Exact names take precedence over glob and regex patterns
+		if rolePermission, ok := lookupRepositoryPermission(*role.Repositories, repositoryName); ok {
+			desiredPermission = &rolePermission
+		}
+	}
+
+	return desiredPermission
+}
+
 func isRobotAccountInPrototypeByRole(prototypes []qc.Prototype, robotAccount string, role string) bool {
 
 	for _, prototype := range prototypes {
@@ -0,0 +1,137 @@
+package quay
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+// requireTeamMembers fails the test unless a team exists with exactly the given members
+func requireTeamMembers(t *testing.T, server *quaytest.Server, teamName string, members ...string) {
+	t.Helper()
+
+	actual, ok := server.TeamMembers(testOrganization, teamName)
+	if !ok {
+		t.Fatalf("expected team '%s' to exist", teamName)
+	}
+
+	if len(actual) != len(members) {
+		t.Fatalf("expected members %v of team '%s', got %v", members, teamName, actual)
+	}
+
+	for i := range members {
+		if actual[i] != members[i] {
+			t.Fatalf("expected members %v of team '%s', got %v", members, teamName, actual)
+		}
+	}
+}
+
+func TestRobotTeams(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddTeam(testOrganization, "platform", qc.QuayTeamRoleMember, "Platform engineering")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"teams":               `{"developers": "member", "platform": "member"}`,
+		"create_repositories": true,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+	username := resp.Data["username"].(string)
+
+	for _, teamName := range []string{"developers", "platform", vaultCreator} {
+		requireTeamMembers(t, server, teamName, username)
+	}
+
+	revokeCredentials(t, b, s, resp.Secret)
+
+	// Teams created by Vault are deleted once empty, existing teams are kept
+	for _, teamName := range []string{"developers", vaultCreator} {
+		if _, ok := server.TeamMembers(testOrganization, teamName); ok {
+			t.Fatalf("expected team '%s' to be deleted", teamName)
+		}
+	}
+
+	requireTeamMembers(t, server, "platform")
+}
+
+func TestDeleteUnusedTeamsOnlyChecksRobotTeams(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	// An empty team created by Vault for another role is not considered when revoking
+	server.AddTeam(testOrganization, "operators", qc.QuayTeamRoleMember, vaultTeamDescription)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"teams": `{"developers": "member"}`,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+	revokeCredentials(t, b, s, resp.Secret)
+
+	if _, ok := server.TeamMembers(testOrganization, "developers"); ok {
+		t.Fatal("expected team 'developers' to be deleted")
+	}
+
+	if _, ok := server.TeamMembers(testOrganization, "operators"); !ok {
+		t.Fatal("expected team 'operators' to be kept")
+	}
+
+	for _, request := range server.Requests() {
+		if strings.Contains(request, "/team/operators") {
+			t.Fatalf("unexpected request for team 'operators': %s", request)
+		}
+	}
+}
+
+func TestDeleteUnusedTeamsWaitsForTeamLock(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"teams": `{"developers": "member"}`,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+
+	// Robot accounts of another role are being added to the teams of the organization
+	lock := locksutil.LockForKey(b.teamLocks, testOrganization)
+	lock.Lock()
+
+	revoked := make(chan error, 1)
+	go func() {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   s,
+			Secret:    resp.Secret,
+		})
+		revoked <- err
+	}()
+
+	select {
+	case err := <-revoked:
+		lock.Unlock()
+		t.Fatalf("expected revoking to wait for the team lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, ok := server.TeamMembers(testOrganization, "developers"); !ok {
+		lock.Unlock()
+		t.Fatal("expected team 'developers' to be kept while the team lock is held")
+	}
+
+	lock.Unlock()
+
+	if err := <-revoked; err != nil {
+		t.Fatalf("error revoking credentials: %v", err)
+	}
+
+	if _, ok := server.TeamMembers(testOrganization, "developers"); ok {
+		t.Fatal("expected team 'developers' to be deleted")
+	}
+}
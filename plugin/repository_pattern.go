@@ -0,0 +1,84 @@
+package quay
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// isRepositoryRegex returns whether a repositories key is an anchored regular expression
+func isRepositoryRegex(key string) bool {
+	return len(key) > 1 && strings.HasPrefix(key, "^") && strings.HasSuffix(key, "$")
+}
+
+// isRepositoryGlob returns whether a repositories key contains glob metacharacters
+func isRepositoryGlob(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
+
+// validateRepositoryPatterns verifies that each glob and regular expression within the repositories of a role can be compiled
+func validateRepositoryPatterns(repositories map[string]Permission) error {
+
+	for key := range repositories {
+		if isRepositoryRegex(key) {
+			if _, err := regexp.Compile(key); err != nil {
+				return fmt.Errorf("invalid repository regex '%s': %w", key, err)
+			}
+		} else if isRepositoryGlob(key) {
+			if _, err := path.Match(key, ""); err != nil {
+				return fmt.Errorf("invalid repository pattern '%s': %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchRepositoryPattern returns whether a repository name matches a glob or regular expression key.
+// Keys that are neither never match; exact names are handled by the caller
+func matchRepositoryPattern(key string, repositoryName string) bool {
+
+	if isRepositoryRegex(key) {
+		re, err := regexp.Compile(key)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(repositoryName)
+	}
+
+	if isRepositoryGlob(key) {
+		matched, err := path.Match(key, repositoryName)
+		return err == nil && matched
+	}
+
+	return false
+}
+
+// lookupRepositoryPermission finds the permission for a repository among the repositories of a role.
+// An exact name takes precedence, followed by the longest matching pattern. Patterns of equal length
+// are resolved by their lexical order so that the result is deterministic
+func lookupRepositoryPermission(repositories map[string]Permission, repositoryName string) (Permission, bool) {
+
+	if permission, ok := repositories[repositoryName]; ok {
+		return permission, true
+	}
+
+	var matchedKey string
+	var matchedPermission Permission
+	found := false
+
+	for key, permission := range repositories {
+		if !matchRepositoryPattern(key, repositoryName) {
+			continue
+		}
+
+		if !found || len(key) > len(matchedKey) || (len(key) == len(matchedKey) && key < matchedKey) {
+			matchedKey = key
+			matchedPermission = permission
+			found = true
+		}
+	}
+
+	return matchedPermission, found
+}
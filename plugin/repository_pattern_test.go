@@ -0,0 +1,108 @@
+package quay
+
+import (
+	"testing"
+
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+func TestDynamicCredentialsRepositoryPatterns(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	for _, repositoryName := range []string{"team-a-api", "team-a-web", "team-b-api"} {
+		server.AddRepository(testOrganization, repositoryName)
+	}
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories": `{"team-a-*": "write", "team-a-web": "admin"}`,
+	})
+
+	resp, _ := readCredentials(t, b, s, "test", testOrganization)
+
+	requireRepositoryPermissions(t, server, testOrganization, resp.Data["username"].(string), map[string]qc.QuayPermission{
+		"team-a-api": qc.QuayPermissionWrite,
+		"team-a-web": qc.QuayPermissionAdmin,
+		"team-b-api": "",
+	})
+}
+
+func TestLookupRepositoryPermission(t *testing.T) {
+	repositories := map[string]Permission{
+		"team-a-web":        PermissionAdmin,
+		"team-a-*":          PermissionWrite,
+		"team-*":            PermissionRead,
+		"^team-[ab]-api$":   PermissionAdmin,
+		"^team-[a-z]-api$":  PermissionWrite,
+		"^team-(a|b)-api$":  PermissionRead,
+		"ops-?":             PermissionRead,
+		"not-a-[pattern":    PermissionAdmin,
+		"^unanchored-regex": PermissionAdmin,
+	}
+
+	tests := []struct {
+		repositoryName string
+		wantPermission Permission
+		wantFound      bool
+	}{
+		// An exact name takes precedence over every pattern
+		{repositoryName: "team-a-web", wantPermission: PermissionAdmin, wantFound: true},
+		// The longest matching pattern wins
+		{repositoryName: "team-a-cli", wantPermission: PermissionWrite, wantFound: true},
+		{repositoryName: "team-c-cli", wantPermission: PermissionRead, wantFound: true},
+		// Patterns of equal length are resolved by their lexical order
+		{repositoryName: "team-a-api", wantPermission: PermissionRead, wantFound: true},
+		{repositoryName: "team-c-api", wantPermission: PermissionWrite, wantFound: true},
+		{repositoryName: "ops-1", wantPermission: PermissionRead, wantFound: true},
+		{repositoryName: "ops-12"},
+		// Regular expressions must be anchored at both ends
+		{repositoryName: "unanchored-regex-web"},
+		{repositoryName: "web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repositoryName, func(t *testing.T) {
+			permission, found := lookupRepositoryPermission(repositories, tt.repositoryName)
+			if found != tt.wantFound || permission != tt.wantPermission {
+				t.Fatalf("expected permission '%s' (found: %t), got '%s' (found: %t)", tt.wantPermission, tt.wantFound, permission, found)
+			}
+		})
+	}
+}
+
+func TestValidateRepositoryPatterns(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "api"},
+		{key: "team-*"},
+		{key: "^team-[a-z]+$"},
+		{key: "team-[a", wantErr: true},
+		{key: "^team-(a$", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if err := validateRepositoryPatterns(map[string]Permission{tt.key: PermissionRead}); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRepositoryPermissionDefault(t *testing.T) {
+	defaultPermission := PermissionRead
+
+	role := &quayRoleEntry{
+		DefaultPermission: &defaultPermission,
+		Repositories:      &map[string]Permission{"team-a-*": PermissionWrite},
+	}
+
+	if permission := role.repositoryPermission("team-a-api"); permission == nil || *permission != PermissionWrite {
+		t.Fatalf("expected a matching pattern to take precedence over default_permission, got %v", permission)
+	}
+
+	if permission := role.repositoryPermission("web"); permission == nil || *permission != PermissionRead {
+		t.Fatalf("expected default_permission for a repository matching no key, got %v", permission)
+	}
+}
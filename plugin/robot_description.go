@@ -0,0 +1,82 @@
+package quay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/template"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	defaultDescriptionTemplate = `Managed by Vault role {{ .RoleName }}{{ if .DisplayName }} for {{ .DisplayName }}{{ end }}`
+)
+
+// descriptionTemplateData is the data available to description templates
+type descriptionTemplateData struct {
+	RoleName      string
+	EntityID      string
+	DisplayName   string
+	MountAccessor string
+	RequestID     string
+}
+
+func newDescriptionTemplateData(roleName string, req *logical.Request) descriptionTemplateData {
+	data := descriptionTemplateData{
+		RoleName: roleName,
+	}
+
+	// Robot accounts provisioned in the background are not requested by a caller
+	if req != nil {
+		data.EntityID = req.EntityID
+		data.DisplayName = req.DisplayName
+		data.MountAccessor = req.MountAccessor
+		data.RequestID = req.ID
+	}
+
+	return data
+}
+
+// descriptionTemplate returns the template used to describe the robot accounts of a role
+func (role *quayRoleEntry) descriptionTemplate() string {
+	if role.DescriptionTemplate != "" {
+		return role.DescriptionTemplate
+	}
+
+	return defaultDescriptionTemplate
+}
+
+// robotAccountRequest returns the description and metadata recorded on a robot account created for a role
+func (role *quayRoleEntry) robotAccountRequest(roleName string, req *logical.Request) (*qc.RobotAccountRequest, error) {
+	descriptionTemplate, err := template.NewTemplate(template.Template(role.descriptionTemplate()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid description_template: %w", err)
+	}
+
+	data := newDescriptionTemplateData(roleName, req)
+
+	description, err := descriptionTemplate.Generate(data)
+	if err != nil {
+		return nil, fmt.Errorf("error generating robot account description: %w", err)
+	}
+
+	metadata := map[string]string{
+		"vault_role": data.RoleName,
+	}
+
+	for key, value := range map[string]string{
+		"vault_entity_id":      data.EntityID,
+		"vault_display_name":   data.DisplayName,
+		"vault_mount_accessor": data.MountAccessor,
+		"vault_request_id":     data.RequestID,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+
+	return &qc.RobotAccountRequest{
+		Description:          description,
+		UnstructuredMetadata: metadata,
+	}, nil
+}
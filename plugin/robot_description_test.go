@@ -0,0 +1,88 @@
+package quay
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRobotDescription(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"description_template": "{{ .RoleName }} requested by {{ .DisplayName }} ({{ .EntityID }})",
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:     logical.ReadOperation,
+		Path:          "creds/test",
+		Storage:       s,
+		EntityID:      "entity-1",
+		DisplayName:   "token-alice",
+		MountAccessor: "quay_1234",
+		ID:            "request-1",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("error reading credentials: %v %v", resp, err)
+	}
+
+	robotName := strings.TrimPrefix(resp.Data["username"].(string), testOrganization+"+")
+
+	robot, ok := server.Robot(testOrganization, robotName)
+	if !ok {
+		t.Fatalf("expected robot account '%s' to exist", robotName)
+	}
+
+	if robot.Description != "test requested by token-alice (entity-1)" {
+		t.Fatalf("unexpected description '%s'", robot.Description)
+	}
+
+	wantMetadata := map[string]string{
+		"vault_role":           "test",
+		"vault_entity_id":      "entity-1",
+		"vault_display_name":   "token-alice",
+		"vault_mount_accessor": "quay_1234",
+		"vault_request_id":     "request-1",
+	}
+
+	for key, value := range wantMetadata {
+		if robot.UnstructuredMetadata[key] != value {
+			t.Fatalf("expected metadata %s '%s', got %v", key, value, robot.UnstructuredMetadata)
+		}
+	}
+}
+
+func TestRobotDescriptionDefault(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "static-roles/deployer", nil)
+	readStaticCredentials(t, b, s, "deployer")
+
+	robot, ok := server.Robot(testOrganization, "deployer")
+	if !ok {
+		t.Fatal("expected robot account 'deployer' to exist")
+	}
+
+	// Requests without a display name are described by the role alone
+	if robot.Description != "Managed by Vault role deployer" {
+		t.Fatalf("unexpected description '%s'", robot.Description)
+	}
+
+	if len(robot.UnstructuredMetadata) != 1 || robot.UnstructuredMetadata["vault_role"] != "deployer" {
+		t.Fatalf("unexpected metadata %v", robot.UnstructuredMetadata)
+	}
+}
+
+func TestRobotDescriptionValidation(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	writeRoleError(t, b, s, "roles/test", map[string]interface{}{
+		"description_template": "{{ .RoleName ",
+	}, "invalid description_template")
+
+	writeRoleError(t, b, s, "roles/test", map[string]interface{}{
+		"description_template": "{{ .Unknown }}",
+	}, "error generating robot account description")
+}
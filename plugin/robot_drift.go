@@ -0,0 +1,265 @@
+package quay
+
+import (
+	"context"
+	"sort"
+
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+// robotDrift describes the differences between a robot account in Quay and the role that manages it
+type robotDrift struct {
+	MissingTeams           []string
+	UnexpectedTeams        []string
+	MissingPrototypes      []string
+	UnexpectedPrototypes   []qc.Prototype
+	MissingRepositories    map[string]Permission
+	IncorrectRepositories  map[string]repositoryPermissionDrift
+	UnexpectedRepositories map[string]Permission
+}
+
+type repositoryPermissionDrift struct {
+	Expected Permission `json:"expected"`
+	Actual   Permission `json:"actual"`
+}
+
+func (d *robotDrift) inSync() bool {
+	return len(d.MissingTeams) == 0 && len(d.UnexpectedTeams) == 0 &&
+		len(d.MissingPrototypes) == 0 && len(d.UnexpectedPrototypes) == 0 &&
+		len(d.MissingRepositories) == 0 && len(d.IncorrectRepositories) == 0 && len(d.UnexpectedRepositories) == 0
+}
+
+func (d *robotDrift) responseData() map[string]interface{} {
+	unexpectedPrototypes := make([]string, 0, len(d.UnexpectedPrototypes))
+	for _, prototype := range d.UnexpectedPrototypes {
+		unexpectedPrototypes = append(unexpectedPrototypes, prototype.Role)
+	}
+
+	return map[string]interface{}{
+		"in_sync": d.inSync(),
+		"teams": map[string]interface{}{
+			"missing":    d.MissingTeams,
+			"unexpected": d.UnexpectedTeams,
+		},
+		"prototypes": map[string]interface{}{
+			"missing":    d.MissingPrototypes,
+			"unexpected": unexpectedPrototypes,
+		},
+		"repositories": map[string]interface{}{
+			"missing":    d.MissingRepositories,
+			"incorrect":  d.IncorrectRepositories,
+			"unexpected": d.UnexpectedRepositories,
+		},
+	}
+}
+
+// getRobotDrift compares the teams, prototypes and repository permissions of a robot account against its role
+func (b *quayBackend) getRobotDrift(ctx context.Context, client *client, robotAccount *qc.RobotAccount, robotName string, role *quayRoleEntry) (*robotDrift, error) {
+	drift := &robotDrift{
+		MissingTeams:           []string{},
+		UnexpectedTeams:        []string{},
+		MissingPrototypes:      []string{},
+		UnexpectedPrototypes:   []qc.Prototype{},
+		MissingRepositories:    map[string]Permission{},
+		IncorrectRepositories:  map[string]repositoryPermissionDrift{},
+		UnexpectedRepositories: map[string]Permission{},
+	}
+
+	if role.NamespaceType == organization {
+		if err := b.getTeamDrift(ctx, client, robotAccount.Name, role, drift); err != nil {
+			return nil, err
+		}
+
+		if err := b.getPrototypeDrift(ctx, client, robotAccount.Name, role, drift); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.getRepositoryDrift(ctx, client, robotName, role, drift); err != nil {
+		return nil, err
+	}
+
+	return drift, nil
+}
+
+func (b *quayBackend) getTeamDrift(ctx context.Context, client *client, robotAccountName string, role *quayRoleEntry, drift *robotDrift) error {
+	quayOrganization, _, apiError := client.GetOrganization(ctx, role.NamespaceName)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	desiredTeams := b.assembleTeams(role)
+
+	for teamName := range quayOrganization.Teams {
+		teamMembers, _, apiError := client.GetTeamMembers(ctx, role.NamespaceName, teamName)
+		if apiError.Error != nil {
+			return apiError.Error
+		}
+
+		_, desired := desiredTeams[teamName]
+		member := isTeamMember(teamMembers.Members, robotAccountName)
+
+		if desired && !member {
+			drift.MissingTeams = append(drift.MissingTeams, teamName)
+		} else if !desired && member {
+			drift.UnexpectedTeams = append(drift.UnexpectedTeams, teamName)
+		}
+	}
+
+	// Teams that do not exist yet are missing
+	for teamName := range desiredTeams {
+		if _, ok := quayOrganization.Teams[teamName]; !ok {
+			drift.MissingTeams = append(drift.MissingTeams, teamName)
+		}
+	}
+
+	sort.Strings(drift.MissingTeams)
+	sort.Strings(drift.UnexpectedTeams)
+
+	return nil
+}
+
+func (b *quayBackend) getPrototypeDrift(ctx context.Context, client *client, robotAccountName string, role *quayRoleEntry, drift *robotDrift) error {
+	organizationPrototypes, _, apiError := client.GetPrototypesByOrganization(ctx, role.NamespaceName)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	found := false
+
+	for _, prototype := range organizationPrototypes.Prototypes {
+		if !prototype.Delegate.Robot || prototype.Delegate.Name != robotAccountName {
+			continue
+		}
+
+		if role.DefaultPermission != nil && prototype.Role == role.DefaultPermission.String() && !found {
+			found = true
+			continue
+		}
+
+		drift.UnexpectedPrototypes = append(drift.UnexpectedPrototypes, prototype)
+	}
+
+	if role.DefaultPermission != nil && !found {
+		drift.MissingPrototypes = append(drift.MissingPrototypes, role.DefaultPermission.String())
+	}
+
+	return nil
+}
+
+func (b *quayBackend) getRepositoryDrift(ctx context.Context, client *client, robotName string, role *quayRoleEntry, drift *robotDrift) error {
+	robotPermissions, _, apiError := client.GetRobotPermissions(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	namespaceRepositories, _, apiError := client.GetRepositoriesForNamespace(ctx, role.NamespaceName)
+	if apiError.Error != nil {
+		return apiError.Error
+	}
+
+	actualPermissions := make(map[string]Permission, len(robotPermissions.Permissions))
+	for _, robotPermission := range robotPermissions.Permissions {
+		actualPermissions[robotPermission.Repository.Name] = Permission(robotPermission.Role)
+	}
+
+	desiredPermissions := map[string]Permission{}
+	for _, namespaceRepository := range namespaceRepositories {
+		if desiredPermission := role.repositoryPermission(namespaceRepository.Name); desiredPermission != nil {
+			desiredPermissions[namespaceRepository.Name] = *desiredPermission
+		}
+	}
+
+	// Repositories the role creates are granted once they have been created
+	if role.CreateMissingRepositories {
+		for _, repositoryName := range role.missingRepositories(namespaceRepositories) {
+			desiredPermissions[repositoryName] = *role.repositoryPermission(repositoryName)
+		}
+	}
+
+	for repositoryName, desiredPermission := range desiredPermissions {
+		actualPermission, ok := actualPermissions[repositoryName]
+		if !ok {
+			drift.MissingRepositories[repositoryName] = desiredPermission
+		} else if actualPermission != desiredPermission {
+			drift.IncorrectRepositories[repositoryName] = repositoryPermissionDrift{
+				Expected: desiredPermission,
+				Actual:   actualPermission,
+			}
+		}
+	}
+
+	for repositoryName, actualPermission := range actualPermissions {
+		if _, ok := desiredPermissions[repositoryName]; !ok {
+			drift.UnexpectedRepositories[repositoryName] = actualPermission
+		}
+	}
+
+	return nil
+}
+
+// reconcileRobot brings a robot account in line with its role, granting missing permissions and
+// removing permissions that the role does not grant. The drift found before reconciling is returned
+func (b *quayBackend) reconcileRobot(ctx context.Context, client *client, robotName string, role *quayRoleEntry, robotAccountRequest *qc.RobotAccountRequest) (*robotDrift, error) {
+	robotAccount, _, apiError := client.GetRobotAccount(ctx, role.NamespaceType.String(), role.NamespaceName, robotName)
+	if isRobotNotFound(apiError.Error) {
+		// A new robot account is created in line with the role
+		newRobotAccount, err := b.createRobot(ctx, client, robotName, role, robotAccountRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		return b.getRobotDrift(ctx, client, newRobotAccount, robotName, role)
+	} else if apiError.Error != nil {
+		return nil, apiError.Error
+	}
+
+	return b.reconcileExistingRobot(ctx, client, &robotAccount, robotName, role)
+}
+
+// reconcileExistingRobot brings an existing robot account in line with its role. The drift found before reconciling is returned
+func (b *quayBackend) reconcileExistingRobot(ctx context.Context, client *client, robotAccount *qc.RobotAccount, robotName string, role *quayRoleEntry) (*robotDrift, error) {
+	drift, err := b.getRobotDrift(ctx, client, robotAccount, robotName, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if drift.inSync() {
+		return drift, nil
+	}
+
+	// Grant missing teams, prototypes and repository permissions
+	if _, err := b.createRobot(ctx, client, robotName, role, nil); err != nil {
+		return nil, err
+	}
+
+	for _, teamName := range drift.UnexpectedTeams {
+		if _, apiError := client.RemoveTeamMember(ctx, role.NamespaceName, teamName, robotAccount.Name); apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+			return nil, apiError.Error
+		}
+	}
+
+	for _, prototype := range drift.UnexpectedPrototypes {
+		if _, apiError := client.DeletePrototype(ctx, role.NamespaceName, prototype.ID); apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+			return nil, apiError.Error
+		}
+	}
+
+	for repositoryName := range drift.UnexpectedRepositories {
+		if _, apiError := client.DeleteRepositoryUserPermission(ctx, role.NamespaceName, repositoryName, robotAccountName(role.NamespaceName, robotName)); apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+			return nil, apiError.Error
+		}
+	}
+
+	return drift, nil
+}
+
+func isTeamMember(members []qc.TeamMember, memberName string) bool {
+	for _, member := range members {
+		if member.Name == memberName {
+			return true
+		}
+	}
+
+	return false
+}
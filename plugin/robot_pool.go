@@ -0,0 +1,370 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	robotPoolStoragePath   = "robot-pool"
+	robotPoolRefillBacklog = 64
+)
+
+// pooledRobotEntry records a fully provisioned robot account that is waiting to be leased
+type pooledRobotEntry struct {
+	dynamicRobotEntry
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+func pooledRobotStoragePath(roleName string, robotName string) string {
+	return fmt.Sprintf("%s/%s/%s", robotPoolStoragePath, roleName, robotName)
+}
+
+func (b *quayBackend) savePooledRobot(ctx context.Context, s logical.Storage, roleName string, pooledRobot *pooledRobotEntry) error {
+	entry, err := logical.StorageEntryJSON(pooledRobotStoragePath(roleName, pooledRobot.RobotName), pooledRobot)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func (b *quayBackend) getPooledRobot(ctx context.Context, s logical.Storage, roleName string, robotName string) (*pooledRobotEntry, error) {
+	entry, err := s.Get(ctx, pooledRobotStoragePath(roleName, robotName))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	pooledRobot := new(pooledRobotEntry)
+	if err := entry.DecodeJSON(pooledRobot); err != nil {
+		return nil, err
+	}
+
+	return pooledRobot, nil
+}
+
+// listPooledRobots returns the names of the robot accounts waiting to be leased for a role
+func (b *quayBackend) listPooledRobots(ctx context.Context, s logical.Storage, roleName string) ([]string, error) {
+	return s.List(ctx, fmt.Sprintf("%s/%s/", robotPoolStoragePath, roleName))
+}
+
+// leasePooledRobot removes a robot account from the pool of a role and tracks it as leased.
+// nil is returned when the pool is empty. The caller must hold the lock for the role
+func (b *quayBackend) leasePooledRobot(ctx context.Context, s logical.Storage, roleName string) (*qc.RobotAccount, error) {
+	robotNames, err := b.listPooledRobots(ctx, s, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, robotName := range robotNames {
+		pooledRobot, err := b.getPooledRobot(ctx, s, roleName, robotName)
+		if err != nil {
+			return nil, err
+		}
+
+		if pooledRobot == nil {
+			continue
+		}
+
+		dynamicRobot := pooledRobot.dynamicRobotEntry
+		dynamicRobot.Created = time.Now()
+
+		if err := b.saveDynamicRobot(ctx, s, roleName, &dynamicRobot); err != nil {
+			return nil, err
+		}
+
+		if err := s.Delete(ctx, pooledRobotStoragePath(roleName, robotName)); err != nil {
+			return nil, err
+		}
+
+		return &qc.RobotAccount{
+			Name:  pooledRobot.Username,
+			Token: pooledRobot.Token,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// drainRobotPool deletes every robot account waiting in the pool of a role. The caller must hold the lock for the role
+func (b *quayBackend) drainRobotPool(ctx context.Context, s logical.Storage, roleName string) error {
+	robotNames, err := b.listPooledRobots(ctx, s, roleName)
+	if err != nil {
+		return err
+	}
+
+	for _, robotName := range robotNames {
+		if err := b.deletePooledRobot(ctx, s, roleName, robotName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// provisioningFields returns a copy of the role holding only the fields used to provision its robot accounts
+func (role *quayRoleEntry) provisioningFields() quayRoleEntry {
+	return quayRoleEntry{
+		Connection:                role.Connection,
+		NamespaceType:             role.NamespaceType,
+		NamespaceName:             role.NamespaceName,
+		CreateRepositories:        role.CreateRepositories,
+		DefaultPermission:         role.DefaultPermission,
+		Teams:                     role.Teams,
+		Repositories:              role.Repositories,
+		UsernameTemplate:          role.UsernameTemplate,
+		DescriptionTemplate:       role.DescriptionTemplate,
+		CreateMissingRepositories: role.CreateMissingRepositories,
+		RepositoryVisibility:      role.RepositoryVisibility,
+		RepositoryDescription:     role.RepositoryDescription,
+	}
+}
+
+// provisioningUnchanged returns whether robot accounts provisioned for one version of a role match another version
+func provisioningUnchanged(previous *quayRoleEntry, role *quayRoleEntry) bool {
+	if previous == nil || role == nil {
+		return previous == role
+	}
+
+	return reflect.DeepEqual(previous.provisioningFields(), role.provisioningFields())
+}
+
+// replaceRobotPool deletes the robot accounts in the pool of a role and queues the pool to be refilled.
+// The caller must hold the lock for the role
+func (b *quayBackend) replaceRobotPool(ctx context.Context, s logical.Storage, roleName string) error {
+	if err := b.drainRobotPool(ctx, s, roleName); err != nil {
+		return err
+	}
+
+	b.requestPoolRefill(roleName)
+
+	return nil
+}
+
+func (b *quayBackend) deletePooledRobot(ctx context.Context, s logical.Storage, roleName string, robotName string) error {
+	pooledRobot, err := b.getPooledRobot(ctx, s, roleName, robotName)
+	if err != nil {
+		return err
+	}
+
+	if pooledRobot != nil {
+		client, err := b.getClient(ctx, s, pooledRobot.Connection)
+		if err != nil {
+			return err
+		}
+
+		if err := b.releaseRobot(ctx, client, robotName, pooledRobot.NamespaceType, pooledRobot.NamespaceName, pooledRobot.Teams, true); err != nil {
+			return err
+		}
+	}
+
+	return s.Delete(ctx, pooledRobotStoragePath(roleName, robotName))
+}
+
+// startRobotPoolWorker starts the background worker that refills the pools of dynamic roles
+func (b *quayBackend) startRobotPoolWorker(s logical.Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b.poolRefills = make(chan string, robotPoolRefillBacklog)
+	b.poolPending = map[string]bool{}
+	b.poolCancel = cancel
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case roleName := <-b.poolRefills:
+				b.poolLock.Lock()
+				delete(b.poolPending, roleName)
+				b.poolLock.Unlock()
+
+				if err := b.refillRobotPool(ctx, s, roleName); err != nil {
+					b.Logger().Error("error refilling robot pool", "role", roleName, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// stopRobotPoolWorker stops the background worker that refills the pools of dynamic roles
+func (b *quayBackend) stopRobotPoolWorker(ctx context.Context) {
+	if b.poolCancel != nil {
+		b.poolCancel()
+	}
+}
+
+// requestPoolRefill queues the pool of a role to be refilled by the background worker
+func (b *quayBackend) requestPoolRefill(roleName string) {
+	if b.poolRefills == nil || !b.canWriteStorage() {
+		return
+	}
+
+	b.poolLock.Lock()
+	defer b.poolLock.Unlock()
+
+	if b.poolPending[roleName] {
+		return
+	}
+
+	select {
+	case b.poolRefills <- roleName:
+		b.poolPending[roleName] = true
+	default:
+		// The pool is refilled by the next periodic run
+	}
+}
+
+// refillRobotPools queues a refill for every dynamic role that maintains a pool
+func (b *quayBackend) refillRobotPools(ctx context.Context, s logical.Storage) error {
+	roleNames, err := s.List(ctx, fmt.Sprintf("%s/", rolesStoragePath))
+	if err != nil {
+		return err
+	}
+
+	for _, roleName := range roleNames {
+		role, err := b.getRole(ctx, rolesStoragePath, roleName, s)
+		if err != nil {
+			return err
+		}
+
+		if role == nil {
+			continue
+		}
+
+		pooledRobots, err := b.listPooledRobots(ctx, s, roleName)
+		if err != nil {
+			return err
+		}
+
+		if len(pooledRobots) != role.PoolSize {
+			b.requestPoolRefill(roleName)
+		}
+	}
+
+	return nil
+}
+
+// refillRobotPool provisions robot accounts until the pool of a role holds pool_size robot accounts
+// and removes any robot accounts in excess of it
+func (b *quayBackend) refillRobotPool(ctx context.Context, s logical.Storage, roleName string) error {
+	for {
+		role, err := b.getRole(ctx, rolesStoragePath, roleName, s)
+		if err != nil {
+			return err
+		}
+
+		poolSize := 0
+		if role != nil {
+			poolSize = role.PoolSize
+		}
+
+		pooledRobots, err := b.listPooledRobots(ctx, s, roleName)
+		if err != nil {
+			return err
+		}
+
+		if len(pooledRobots) > poolSize {
+			if err := b.shrinkRobotPool(ctx, s, roleName, poolSize); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		if len(pooledRobots) == poolSize {
+			return nil
+		}
+
+		added, err := b.addPooledRobot(ctx, s, roleName, role)
+		if err != nil || !added {
+			return err
+		}
+	}
+}
+
+func (b *quayBackend) shrinkRobotPool(ctx context.Context, s logical.Storage, roleName string, poolSize int) error {
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	robotNames, err := b.listPooledRobots(ctx, s, roleName)
+	if err != nil {
+		return err
+	}
+
+	for i := poolSize; i < len(robotNames); i++ {
+		if err := b.deletePooledRobot(ctx, s, roleName, robotNames[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addPooledRobot provisions a single robot account for the pool of a role. The role lock is only held
+// once the robot account has been provisioned so that credentials can be leased in the meantime. The
+// robot account is discarded if the role changed while it was being provisioned
+func (b *quayBackend) addPooledRobot(ctx context.Context, s logical.Storage, roleName string, role *quayRoleEntry) (bool, error) {
+	client, err := b.getClient(ctx, s, role.Connection)
+	if err != nil {
+		return false, err
+	}
+
+	// Pooled robot accounts are not provisioned on behalf of a caller
+	robotName, err := role.generateRobotName(roleName, "")
+	if err != nil {
+		return false, err
+	}
+
+	robotAccountRequest, err := role.robotAccountRequest(roleName, nil)
+	if err != nil {
+		return false, err
+	}
+
+	robotAccount, walID, err := b.provisionDynamicRobot(ctx, s, client, robotName, role, robotAccountRequest)
+	if err != nil {
+		return false, err
+	}
+
+	lock := locksutil.LockForKey(b.roleLocks, roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	currentRole, err := b.getRole(ctx, rolesStoragePath, roleName, s)
+	if err != nil {
+		return false, err
+	}
+
+	if !provisioningUnchanged(role, currentRole) {
+		// The WAL entry removes the robot account
+		return false, nil
+	}
+
+	if err := b.savePooledRobot(ctx, s, roleName, &pooledRobotEntry{
+		dynamicRobotEntry: *b.newDynamicRobotEntry(role, robotName),
+		Username:          robotAccount.Name,
+		Token:             robotAccount.Token,
+	}); err != nil {
+		return false, err
+	}
+
+	if err := framework.DeleteWAL(ctx, s, walID); err != nil {
+		return false, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	b.Logger().Debug("added robot account to pool", "role", roleName, "robot", robotAccount.Name)
+
+	return true, nil
+}
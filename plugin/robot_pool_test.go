@@ -0,0 +1,116 @@
+package quay
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+// fillRobotPool fills the pool of a role and returns the names of the pooled robot accounts
+func fillRobotPool(t *testing.T, b *quayBackend, s logical.Storage, roleName string) []string {
+	t.Helper()
+
+	if err := b.refillRobotPool(context.Background(), s, roleName); err != nil {
+		t.Fatal(err)
+	}
+
+	robotNames, err := b.listPooledRobots(context.Background(), s, roleName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return robotNames
+}
+
+func TestRobotPool(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	// The pool is filled by the test rather than in the background
+	b.stopRobotPoolWorker(context.Background())
+
+	server.AddRepository(testOrganization, "api")
+
+	role := map[string]interface{}{
+		"repositories": `{"api": "read"}`,
+		"pool_size":    2,
+	}
+	writeRole(t, b, s, "roles/test", role)
+
+	pooledRobots := fillRobotPool(t, b, s, "test")
+	if len(pooledRobots) != 2 {
+		t.Fatalf("expected 2 pooled robot accounts, got %v", pooledRobots)
+	}
+
+	// Changes that do not affect provisioning keep the pool
+	role["ttl"] = 600
+	writeRole(t, b, s, "roles/test", role)
+
+	if robotNames := fillRobotPool(t, b, s, "test"); !reflect.DeepEqual(robotNames, pooledRobots) {
+		t.Fatalf("expected pooled robot accounts %v to be kept, got %v", pooledRobots, robotNames)
+	}
+
+	// Changes that affect provisioning replace the pool
+	role["repositories"] = `{"api": "write"}`
+	writeRole(t, b, s, "roles/test", role)
+
+	for _, robotName := range pooledRobots {
+		requireRobot(t, server, testOrganization, robotName, false)
+	}
+
+	pooledRobots = fillRobotPool(t, b, s, "test")
+	if len(pooledRobots) != 2 {
+		t.Fatalf("expected 2 pooled robot accounts, got %v", pooledRobots)
+	}
+
+	// Credentials are leased from the pool
+	resp, robotName := readCredentials(t, b, s, "test", testOrganization)
+
+	if robotName != pooledRobots[0] && robotName != pooledRobots[1] {
+		t.Fatalf("expected a pooled robot account, got '%s'", robotName)
+	}
+
+	requireRepositoryPermissions(t, server, testOrganization, resp.Data["username"].(string), map[string]qc.QuayPermission{"api": qc.QuayPermissionWrite})
+
+	if robotNames, err := b.listPooledRobots(context.Background(), s, "test"); err != nil || len(robotNames) != 1 {
+		t.Fatalf("expected 1 pooled robot account to remain, got %v", robotNames)
+	}
+
+	// Deleting the role drains the pool
+	handleRequest(t, b, s, logical.DeleteOperation, "roles/test", nil)
+
+	for _, pooledRobot := range pooledRobots {
+		if pooledRobot != robotName {
+			requireRobot(t, server, testOrganization, pooledRobot, false)
+		}
+	}
+}
+
+func TestProvisioningUnchanged(t *testing.T) {
+	role := &quayRoleEntry{
+		NamespaceType: NamespaceTypeOrganization,
+		NamespaceName: testOrganization,
+		Repositories:  &map[string]Permission{"api": PermissionRead},
+		PoolSize:      2,
+	}
+
+	updated := *role
+	updated.TTL = 600
+	updated.PoolSize = 5
+	updated.MaxIdle = 3600
+
+	if !provisioningUnchanged(role, &updated) {
+		t.Fatal("expected ttl, pool_size and max_idle not to affect provisioning")
+	}
+
+	updated.DescriptionTemplate = "{{ .RoleName }}"
+	if provisioningUnchanged(role, &updated) {
+		t.Fatal("expected description_template to affect provisioning")
+	}
+
+	if provisioningUnchanged(nil, role) || provisioningUnchanged(role, nil) {
+		t.Fatal("expected a created or deleted role to affect provisioning")
+	}
+}
@@ -0,0 +1,131 @@
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	qc "github.com/redhat-cop/vault-plugin-secrets-quay/client"
+)
+
+const (
+	walRobotKind      = "robot"
+	walRollbackMinAge = 5 * time.Minute
+)
+
+// walRobot records a dynamic robot account that is about to be provisioned so
+// that it can be removed if provisioning does not complete
+type walRobot struct {
+	Connection    string        `json:"connection,omitempty"`
+	NamespaceType NamespaceType `json:"namespace_type"`
+	NamespaceName string        `json:"namespace_name"`
+	RobotName     string        `json:"robot_name"`
+	Teams         []string      `json:"teams,omitempty"`
+}
+
+func (b *quayBackend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case walRobotKind:
+		return b.rollbackRobot(ctx, req, data)
+	default:
+		return fmt.Errorf("unknown rollback type %q", kind)
+	}
+}
+
+func (b *quayBackend) rollbackRobot(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walRobot
+
+	raw, err := jsonutil.EncodeJSON(data)
+	if err != nil {
+		return err
+	}
+
+	if err := jsonutil.DecodeJSON(raw, &entry); err != nil {
+		return err
+	}
+
+	client, err := b.getClient(ctx, req.Storage, entry.Connection)
+	if err != nil {
+		return err
+	}
+
+	b.Logger().Debug("rolling back robot account", "namespace", entry.NamespaceName, "robot", entry.RobotName)
+
+	if entry.NamespaceType == NamespaceTypeOrganization {
+		robotAccountName := fmt.Sprintf("%s+%s", entry.NamespaceName, entry.RobotName)
+
+		// Remove Team Memberships
+		for _, team := range entry.Teams {
+			_, apiError := client.RemoveTeamMember(ctx, entry.NamespaceName, team, robotAccountName)
+			if apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+				return apiError.Error
+			}
+		}
+
+		// Remove Prototypes
+		organizationPrototypes, _, apiError := client.GetPrototypesByOrganization(ctx, entry.NamespaceName)
+		if apiError.Error != nil {
+			return apiError.Error
+		}
+
+		for _, prototype := range organizationPrototypes.Prototypes {
+			if prototype.Delegate.Robot && prototype.Delegate.Name == robotAccountName {
+				_, apiError := client.DeletePrototype(ctx, entry.NamespaceName, prototype.ID)
+				if apiError.Error != nil && !qc.IsNotFound(apiError.Error) {
+					return apiError.Error
+				}
+			}
+		}
+	}
+
+	_, apiError := client.DeleteRobotAccount(ctx, entry.NamespaceType.String(), entry.NamespaceName, entry.RobotName)
+
+	if apiError.Error != nil && !isRobotNotFound(apiError.Error) {
+		return apiError.Error
+	}
+
+	if entry.NamespaceType == NamespaceTypeOrganization {
+		return b.deleteUnusedTeams(ctx, client, entry.NamespaceName, entry.Teams)
+	}
+
+	return nil
+}
+
+// walRobotNames returns the robot accounts that are being provisioned keyed by namespace and robot name
+func walRobotNames(ctx context.Context, s logical.Storage) (map[string]bool, error) {
+	walIDs, err := framework.ListWAL(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	robotNames := make(map[string]bool, len(walIDs))
+
+	for _, walID := range walIDs {
+		walEntry, err := framework.GetWAL(ctx, s, walID)
+		if err != nil {
+			return nil, err
+		}
+
+		if walEntry == nil || walEntry.Kind != walRobotKind {
+			continue
+		}
+
+		var entry walRobot
+
+		raw, err := jsonutil.EncodeJSON(walEntry.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := jsonutil.DecodeJSON(raw, &entry); err != nil {
+			return nil, err
+		}
+
+		robotNames[fmt.Sprintf("%s/%s", namespaceKey(entry.Connection, entry.NamespaceType, entry.NamespaceName), entry.RobotName)] = true
+	}
+
+	return robotNames, nil
+}
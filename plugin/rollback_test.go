@@ -0,0 +1,93 @@
+package quay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+func TestDynamicCredentialsRollback(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	server.AddRepository(testOrganization, "api")
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"repositories": `{"api": "write"}`,
+		"teams":        `{"developers": "member"}`,
+	})
+
+	server.InjectFailure(quaytest.Failure{
+		Method:     "PUT",
+		Path:       "/api/v1/repository/*/*/permissions/user/*",
+		StatusCode: 500,
+	})
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+		Storage:   s,
+	}); err == nil {
+		t.Fatal("expected error reading credentials")
+	}
+
+	if robots := server.Robots(testOrganization); len(robots) != 1 {
+		t.Fatalf("expected the partially provisioned robot account to exist, got %v", robots)
+	}
+
+	server.ClearFailures()
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"immediate": true,
+		},
+	}); err != nil {
+		t.Fatalf("error rolling back: %v", err)
+	}
+
+	if robots := server.Robots(testOrganization); len(robots) != 0 {
+		t.Fatalf("expected the robot account to be removed, got %v", robots)
+	}
+
+	if _, ok := server.TeamMembers(testOrganization, "developers"); ok {
+		t.Fatal("expected team 'developers' to be deleted")
+	}
+}
+
+func TestDynamicCredentialsRemoveWAL(t *testing.T) {
+	b, s, server := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	_, robotName := readCredentials(t, b, s, "test", testOrganization)
+
+	walIDs, err := framework.ListWAL(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(walIDs) != 0 {
+		t.Fatalf("expected the WAL entry to be removed once provisioned, got %v", walIDs)
+	}
+
+	requireRobot(t, server, testOrganization, robotName, true)
+}
+
+func TestRollbackRobotNotCreated(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	// Provisioning may fail before the robot account is created
+	err := b.rollbackRobot(context.Background(), &logical.Request{Storage: s}, &walRobot{
+		NamespaceType: NamespaceTypeOrganization,
+		NamespaceName: testOrganization,
+		RobotName:     "test-missing",
+		Teams:         []string{"developers"},
+	})
+	if err != nil {
+		t.Fatalf("error rolling back a robot account that was never created: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package quay
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/template"
+)
+
+const (
+	defaultUsernameTemplate = `{{ .RoleName }}-{{ random 5 | lowercase }}`
+
+	// Placeholders substituted for generated values when deriving the pattern of a username template
+	randomPlaceholder      = "\x00"
+	unixTimePlaceholder    = "\x01"
+	uuidPlaceholder        = "\x02"
+	timestampPlaceholder   = "\x03"
+	displayNamePlaceholder = "\x04"
+)
+
+var (
+	randomPlaceholderRegex = regexp.MustCompile(regexp.QuoteMeta(randomPlaceholder) + `(\d+)` + regexp.QuoteMeta(randomPlaceholder))
+)
+
+// usernameTemplateData is the data available to username templates
+type usernameTemplateData struct {
+	RoleName    string
+	DisplayName string
+}
+
+// usernameTemplate returns the template used to name the robot accounts of a dynamic role
+func (role *quayRoleEntry) usernameTemplate() string {
+	if role.UsernameTemplate != "" {
+		return role.UsernameTemplate
+	}
+
+	return defaultUsernameTemplate
+}
+
+// generateRobotName renders the username template of a dynamic role and verifies that Quay accepts the result
+func (role *quayRoleEntry) generateRobotName(roleName string, displayName string) (string, error) {
+	usernameTemplate, err := template.NewTemplate(template.Template(role.usernameTemplate()))
+	if err != nil {
+		return "", fmt.Errorf("invalid username_template: %w", err)
+	}
+
+	robotName, err := usernameTemplate.Generate(usernameTemplateData{
+		RoleName:    roleName,
+		DisplayName: displayName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error generating robot account name: %w", err)
+	}
+
+	if err := validateRobotName(role.NamespaceName, robotName); err != nil {
+		return "", err
+	}
+
+	return robotName, nil
+}
+
+// generatedRobotNameRegex returns a pattern matching the robot account names the username template
+// of a dynamic role generates. Generated values are replaced with placeholders while rendering the
+// template so that only the literal parts of the name are matched exactly
+func (role *quayRoleEntry) generatedRobotNameRegex(roleName string) (*regexp.Regexp, error) {
+	rendered, err := role.renderUsernameTemplatePlaceholders(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := regexp.QuoteMeta(rendered)
+
+	pattern = randomPlaceholderRegex.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		length, _ := strconv.Atoi(strings.Trim(placeholder, randomPlaceholder))
+		return fmt.Sprintf("[A-Za-z0-9]{%d}", length)
+	})
+
+	pattern = strings.NewReplacer(
+		unixTimePlaceholder, "[0-9]+",
+		uuidPlaceholder, "[0-9a-f-]{36}",
+		timestampPlaceholder, "[a-z0-9._-]+",
+		displayNamePlaceholder, "[a-z0-9._-]*",
+	).Replace(pattern)
+
+	return regexp.Compile(fmt.Sprintf("^%s$", pattern))
+}
+
+// renderUsernameTemplatePlaceholders renders the username template of a dynamic role with generated values replaced by placeholders
+func (role *quayRoleEntry) renderUsernameTemplatePlaceholders(roleName string) (string, error) {
+	usernameTemplate, err := template.NewTemplate(
+		template.Template(role.usernameTemplate()),
+		template.Function("random", func(length int) string {
+			return fmt.Sprintf("%s%d%s", randomPlaceholder, length, randomPlaceholder)
+		}),
+		template.Function("unix_time", func() string { return unixTimePlaceholder }),
+		template.Function("unix_time_millis", func() string { return unixTimePlaceholder }),
+		template.Function("uuid", func() string { return uuidPlaceholder }),
+		template.Function("timestamp", func(string) string { return timestampPlaceholder }),
+	)
+	if err != nil {
+		return "", fmt.Errorf("invalid username_template: %w", err)
+	}
+
+	return usernameTemplate.Generate(usernameTemplateData{
+		RoleName:    roleName,
+		DisplayName: displayNamePlaceholder,
+	})
+}
+
+// validateUsernameTemplate verifies that a username template can be rendered into a valid robot account
+// name. The template must use random or unix_time so that each robot account is given a new name, as
+// robot accounts that already exist are never reused for dynamic credentials
+func (role *quayRoleEntry) validateUsernameTemplate(roleName string) error {
+	if _, err := role.generateRobotName(roleName, "token"); err != nil {
+		return err
+	}
+
+	rendered, err := role.renderUsernameTemplatePlaceholders(roleName)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(rendered, randomPlaceholder) && !strings.Contains(rendered, unixTimePlaceholder) {
+		return fmt.Errorf("username_template must use random or unix_time to generate unique robot account names")
+	}
+
+	_, err = role.generatedRobotNameRegex(roleName)
+
+	return err
+}
@@ -0,0 +1,120 @@
+package quay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/redhat-cop/vault-plugin-secrets-quay/client/quaytest"
+)
+
+func TestUsernameTemplate(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"username_template": "{{ .RoleName }}_{{ unix_time }}_{{ random 4 | lowercase }}",
+	})
+
+	_, robotName := readCredentials(t, b, s, "test", testOrganization)
+
+	role, err := b.getRole(context.Background(), rolesStoragePath, "test", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generatedRobotNameRegex, err := role.generatedRobotNameRegex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(robotName, "test_") || !generatedRobotNameRegex.MatchString(robotName) {
+		t.Fatalf("unexpected robot account name '%s'", robotName)
+	}
+}
+
+func TestUsernameTemplateValidation(t *testing.T) {
+	b, s, _ := getTestBackend(t)
+
+	tests := []struct {
+		name             string
+		usernameTemplate string
+		wantErr          string
+	}{
+		{
+			name:             "fixed name",
+			usernameTemplate: "{{ .RoleName }}",
+			wantErr:          "username_template must use random or unix_time",
+		},
+		{
+			name:             "display name only",
+			usernameTemplate: "{{ .RoleName }}_{{ .DisplayName }}",
+			wantErr:          "username_template must use random or unix_time",
+		},
+		{
+			name:             "invalid syntax",
+			usernameTemplate: "{{ .RoleName ",
+			wantErr:          "invalid username_template",
+		},
+		{
+			name:             "invalid robot account name",
+			usernameTemplate: "{{ .RoleName }}!{{ random 4 | lowercase }}",
+			wantErr:          "must match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeRoleError(t, b, s, "roles/test", map[string]interface{}{
+				"username_template": tt.usernameTemplate,
+			}, tt.wantErr)
+		})
+	}
+
+	writeRole(t, b, s, "roles/test", map[string]interface{}{
+		"username_template": "{{ .RoleName }}_{{ unix_time }}",
+	})
+}
+
+func TestProvisionDynamicRobotExists(t *testing.T) {
+	b, s, server := getTestBackend(t)
+	ctx := context.Background()
+
+	server.AddRobot(testOrganization, "existing")
+
+	writeRole(t, b, s, "roles/test", nil)
+
+	role, err := b.getRole(ctx, rolesStoragePath, "test", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := b.getClient(ctx, s, role.Connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := b.provisionDynamicRobot(ctx, s, client, "existing", role, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected provisioning an existing robot account to fail, got %v", err)
+	}
+
+	// The robot account is created between checking for it and creating it
+	server.InjectFailure(quaytest.Failure{Method: http.MethodGet, Path: "/api/v1/organization/example/robots/existing", StatusCode: http.StatusNotFound, Count: 1})
+
+	if _, _, err := b.provisionDynamicRobot(ctx, s, client, "existing", role, nil); err == nil {
+		t.Fatal("expected provisioning an existing robot account to fail")
+	}
+
+	// No WAL entry is left to remove the existing robot account
+	walIDs, err := framework.ListWAL(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(walIDs) != 0 {
+		t.Fatalf("expected no WAL entries, got %v", walIDs)
+	}
+
+	requireRobot(t, server, testOrganization, "existing", true)
+}